@@ -4,11 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"math"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -19,25 +20,27 @@ import (
 
 // ----- VARS
 var (
-	botVersion        = "8.3@GO1.22.1"
-	inviteLink        = ""
-	ownerID           = ""
-	defaultColor      = 0x7289da
-	successColor      = 0x76e06e
-	failColor         = 0xe06c6c
-	onlineColor       = 0x43b581
-	offlineColor      = 0x727c8a
-	actionQueue       []Request
-	startedCoroutines = false
-	startTime         = time.Now().Unix()
+	botVersion      = "8.3@GO1.22.1"
+	inviteLink      = ""
+	ownerID         = ""
+	defaultColor    = 0x7289da
+	successColor    = 0x76e06e
+	failColor       = 0xe06c6c
+	onlineColor     = 0x43b581
+	offlineColor    = 0x727c8a
+	flappingColor   = 0xfaa61a
+	idleColor       = 0xfaa61a
+	dndColor        = 0xf04747
+	actionQueue     = make(chan journalEntry, 1024)
+	actionJournal   *journal
+	state           *cachedStore
+	store           Store
+	history         History
+	startCoroutines sync.Once
+	startTime       = time.Now().Unix()
 )
 
 // ----- STRUCTS
-type Request struct {
-	action string
-	data   [4]string
-}
-
 type Bot struct {
 	ID          string   `json:"id"`
 	Guilds      []string `json:"guilds"`
@@ -47,14 +50,108 @@ type Bot struct {
 }
 
 type Guild struct {
-	ID   string   `json:"id"`
-	CID  string   `json:"cid"`
-	Bots []string `json:"bots"`
+	ID       string        `json:"id"`
+	CID      string        `json:"cid"`
+	Bots     []string      `json:"bots"`
+	Settings GuildSettings `json:"settings"`
+}
+
+// per server settings, the zero value keeps the original behaviour
+type GuildSettings struct {
+	// seconds a bot has to stay offline (or back online) before it's reported
+	GracePeriod int64 `json:"gracePeriod,omitempty"`
+	// per bot overrides of GracePeriod
+	BotGracePeriods map[string]int64 `json:"botGracePeriods,omitempty"`
+	Notify          NotifySettings   `json:"notify"`
+	Digest          DigestSettings   `json:"digest"`
+	// channels alerts about particular bots go to instead of CID
+	BotChannels map[string]string `json:"botChannels,omitempty"`
+	// channels for bots with a role, the first matching role wins
+	RoleChannels []RoleChannel `json:"roleChannels,omitempty"`
+	// bots always or never watched, ExplicitOnly watches only Include
+	Include      []string `json:"include,omitempty"`
+	Exclude      []string `json:"exclude,omitempty"`
+	ExplicitOnly bool     `json:"explicitOnly,omitempty"`
+	// who gets pinged about any bot, and about particular bots on top of that
+	Mentions    MentionSettings            `json:"mentions"`
+	BotMentions map[string]MentionSettings `json:"botMentions,omitempty"`
+	// custom alert embeds by alert kind
+	Templates map[string]AlertTemplate `json:"templates,omitempty"`
+	Webhook   WebhookSettings          `json:"webhook"`
+	Board     BoardSettings            `json:"board"`
+}
+
+// the status board message kept up to date in a server
+type BoardSettings struct {
+	CID string `json:"channel,omitempty"`
+	MID string `json:"message,omitempty"`
+}
+
+// where a server's alerts are posted as signed JSON
+type WebhookSettings struct {
+	URL string `json:"url,omitempty"`
+	// key the payloads are signed with
+	Secret string `json:"secret,omitempty"`
+}
+
+// text/templates for the parts of an alert embed, empty ones keep the default
+type AlertTemplate struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// hex color like #ff0000
+	Color  string `json:"color,omitempty"`
+	Footer string `json:"footer,omitempty"`
+}
+
+// roles and users pinged when a bot goes offline
+type MentionSettings struct {
+	Roles []string `json:"roles,omitempty"`
+	Users []string `json:"users,omitempty"`
+	// also ping when the bot comes back online
+	Recovery bool `json:"recovery,omitempty"`
+}
+
+// routes alerts about bots with a role to a channel
+type RoleChannel struct {
+	RID string `json:"role"`
+	CID string `json:"channel"`
+}
+
+// when a server gets availability digests
+type DigestSettings struct {
+	// "daily", "weekly", "monthly" or empty for no digests
+	Cadence string `json:"cadence,omitempty"`
+	// unix time of the last digest, or of when the cadence was set
+	LastSent int64 `json:"lastSent,omitempty"`
 }
 
 type Subscriber struct {
-	ID   string   `json:"id"`
-	Bots []string `json:"bots"`
+	ID       string             `json:"id"`
+	Bots     []string           `json:"bots"`
+	Settings SubscriberSettings `json:"settings"`
+}
+
+// per subscriber settings, the zero value keeps the original behaviour
+type SubscriberSettings struct {
+	Notify NotifySettings `json:"notify"`
+	Email  EmailSettings  `json:"email"`
+}
+
+// an address alerts are emailed to once it's verified
+type EmailSettings struct {
+	Address  string `json:"address,omitempty"`
+	Verified bool   `json:"verified,omitempty"`
+	// hash of the verification code and unix time it was sent
+	CodeHash string `json:"codeHash,omitempty"`
+	CodeSent int64  `json:"codeSent,omitempty"`
+}
+
+// opt-in alerts on top of going offline and coming back online
+type NotifySettings struct {
+	// online, idle and dnd changing between each other
+	Status bool `json:"status,omitempty"`
+	// activity or custom status text changing
+	Activity bool `json:"activity,omitempty"`
 }
 
 // -----  RUN
@@ -77,6 +174,57 @@ func main() {
 	ownerID = os.Getenv("OWNER_ID")
 	inviteLink = os.Getenv("INVITE_LINK")
 
+	// SUBCOMMANDS
+	if len(os.Args) > 1 {
+		runSubcommand(os.Args[1], os.Args[2:])
+		return
+	}
+
+	// OPENING STORE
+	backing, err := openStore()
+	if err != nil {
+		log.Fatal("[STORE] error opening store |", err)
+	}
+	from, to, err := migrateStore(backing)
+	if err != nil {
+		log.Fatal("[MIGRATE] error migrating store |", err)
+	}
+	if from != to {
+		log.Println("[MIGRATE] migrated store from version", from, "to", to)
+	}
+	// OPENING HISTORY
+	history, err = openHistory(backing)
+	if err != nil {
+		log.Fatal("[HISTORY] error opening history |", err)
+	}
+	defer history.Close()
+	// OPENING DEAD LETTERS
+	deadLetters, err = openDeadLetters(backing)
+	if err != nil {
+		log.Fatal("[DEAD LETTERS] error opening dead letters |", err)
+	}
+	defer deadLetters.Close()
+	// OPENING JOURNAL
+	actionJournal, err = openJournal(journalPath())
+	if err != nil {
+		log.Fatal("[JOURNAL] error opening journal |", err)
+	}
+	defer actionJournal.Close()
+	compactJournal := func(mark uint64) {
+		err := actionJournal.compact(mark)
+		if err != nil {
+			log.Println("[JOURNAL] error compacting journal |", err)
+		}
+	}
+
+	// LOADING STATE
+	state, err = newCachedStore(backing, flushInterval(), compactJournal)
+	if err != nil {
+		log.Fatal("[STORE] error loading state |", err)
+	}
+	store = state
+	defer store.Close()
+
 	// CREATING BOT INSTANCE
 	discord, err := discordgo.New("Bot " + TOKEN)
 	if err != nil {
@@ -84,17 +232,143 @@ func main() {
 		os.Exit(1)
 	}
 
+	// apply whatever the last run didn't get to store
+	replayJournal(discord)
+
 	// REGISTER CALLBACKS
 	discord.AddHandler(ready)
 	discord.AddHandler(commandHandler)
 	discord.AddHandler(checkOffline)
-	discord.AddHandler(reaction)
+	discord.AddHandler(presenceUpdate)
+	discord.AddHandler(componentHandler)
 
 	var (
 		dmPermission            = false
 		channelPermission int64 = discordgo.PermissionManageChannels
+		ownerPermission   int64 = discordgo.PermissionAdministrator
+		minGracePeriod          = 0.0
+		maxGracePeriod          = 86400.0
+
+		templateKindOption = &discordgo.ApplicationCommandOption{
+			Name:        "alert",
+			Description: "The kind of alert",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    true,
+			Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{Name: "offline", Value: "offline"},
+				{Name: "online", Value: "online"},
+				{Name: "flapping", Value: "flapping"},
+				{Name: "stopped flapping", Value: "stable"},
+				{Name: "status change", Value: "status"},
+				{Name: "activity change", Value: "activity"},
+			},
+		}
 
 		commands = []*discordgo.ApplicationCommand{
+			{
+				Name:                     "board",
+				DefaultMemberPermissions: &channelPermission,
+				DMPermission:             &dmPermission,
+				Description:              "A status board of every bot watched in a server, kept up to date",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "create",
+						Description: "Posts and pins the status board in this channel",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+					},
+					{
+						Name:        "remove",
+						Description: "Deletes the status board",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+					},
+				},
+			},
+			{
+				Name:                     "deadletter",
+				DefaultMemberPermissions: &ownerPermission,
+				Description:              "[OWNER ONLY] Alerts that couldn't be delivered",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "list",
+						Description: "Lists the newest dead letters",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+					},
+					{
+						Name:        "replay",
+						Description: "Tries delivering dead letters again",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "id",
+								Description: "The dead letter to replay, leave empty for all of them",
+								Type:        discordgo.ApplicationCommandOptionInteger,
+							},
+						},
+					},
+					{
+						Name:        "drop",
+						Description: "Deletes dead letters",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "id",
+								Description: "The dead letter to drop, leave empty for all of them",
+								Type:        discordgo.ApplicationCommandOptionInteger,
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:                     "digest",
+				DefaultMemberPermissions: &channelPermission,
+				DMPermission:             &dmPermission,
+				Description:              "Availability digests of the bots watched in a server",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "schedule",
+						Description: "Sets how often a digest is posted in the channel set with /watch set",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "cadence",
+								Description: "How often to post a digest",
+								Type:        discordgo.ApplicationCommandOptionString,
+								Required:    true,
+								Choices: []*discordgo.ApplicationCommandOptionChoice{
+									{Name: "off", Value: "off"},
+									{Name: "daily", Value: "daily"},
+									{Name: "weekly", Value: "weekly"},
+									{Name: "monthly", Value: "monthly"},
+								},
+							},
+						},
+					},
+					{
+						Name:        "now",
+						Description: "Posts a digest of the last 7 days here",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+					},
+				},
+			},
+			{
+				Name:        "history",
+				Description: "Lists the times a bot went offline",
+				Type:        discordgo.ChatApplicationCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "bot",
+						Description: "The bot to show",
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Required:    true,
+					},
+					{
+						Name:        "since",
+						Description: "How far back to look, like 12h, 7d or 2w (7d by default)",
+						Type:        discordgo.ApplicationCommandOptionString,
+					},
+				},
+			},
 			{
 				Name:        "invite",
 				Description: "Sends an invite link for the bot",
@@ -117,6 +391,81 @@ func main() {
 					},
 				},
 			},
+			{
+				Name:                     "mention",
+				DefaultMemberPermissions: &channelPermission,
+				DMPermission:             &dmPermission,
+				Description:              "Pings roles or users when a bot goes offline",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "add",
+						Description: "Pings a role or user when a bot goes offline",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "role",
+								Description: "The role to ping",
+								Type:        discordgo.ApplicationCommandOptionRole,
+							},
+							{
+								Name:        "user",
+								Description: "The user to ping",
+								Type:        discordgo.ApplicationCommandOptionUser,
+							},
+							{
+								Name:        "bot",
+								Description: "Only ping for this bot",
+								Type:        discordgo.ApplicationCommandOptionUser,
+							},
+						},
+					},
+					{
+						Name:        "remove",
+						Description: "Stops pinging a role or user",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "role",
+								Description: "The role to stop pinging",
+								Type:        discordgo.ApplicationCommandOptionRole,
+							},
+							{
+								Name:        "user",
+								Description: "The user to stop pinging",
+								Type:        discordgo.ApplicationCommandOptionUser,
+							},
+							{
+								Name:        "bot",
+								Description: "Only stop pinging for this bot",
+								Type:        discordgo.ApplicationCommandOptionUser,
+							},
+						},
+					},
+					{
+						Name:        "recovery",
+						Description: "Also pings when a bot comes back online",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "enabled",
+								Description: "Whether to ping on recovery",
+								Type:        discordgo.ApplicationCommandOptionBoolean,
+								Required:    true,
+							},
+							{
+								Name:        "bot",
+								Description: "Only set it for this bot",
+								Type:        discordgo.ApplicationCommandOptionUser,
+							},
+						},
+					},
+					{
+						Name:        "list",
+						Description: "Lists who gets pinged in this server",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+					},
+				},
+			},
 			{
 				Name:         "notify",
 				Description:  "Subscribe to a bot to be notified when it goes online/offline",
@@ -148,6 +497,48 @@ func main() {
 							},
 						},
 					},
+					{
+						Name:        "email",
+						Description: "Also emails you alerts, leave empty to stop",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "address",
+								Description: "The address to email, a code is sent to check it's yours",
+								Type:        discordgo.ApplicationCommandOptionString,
+							},
+						},
+					},
+					{
+						Name:        "verify",
+						Description: "Confirms your email address with the code that was sent to it",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "code",
+								Description: "The 6 digit code from the email",
+								Type:        discordgo.ApplicationCommandOptionString,
+								Required:    true,
+							},
+						},
+					},
+					{
+						Name:        "settings",
+						Description: "Chooses what else you're notified about, leave empty to see your settings",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "status",
+								Description: "Also notify when a bot switches between online, idle and dnd",
+								Type:        discordgo.ApplicationCommandOptionBoolean,
+							},
+							{
+								Name:        "activity",
+								Description: "Also notify when a bot's activity or custom status changes",
+								Type:        discordgo.ApplicationCommandOptionBoolean,
+							},
+						},
+					},
 				},
 			},
 			{
@@ -155,6 +546,60 @@ func main() {
 				Description: "Sends OfflineNotifier's privacy policy",
 				Type:        discordgo.ChatApplicationCommand,
 			},
+			{
+				Name:                     "route",
+				DefaultMemberPermissions: &channelPermission,
+				DMPermission:             &dmPermission,
+				Description:              "Sends alerts about some bots to a channel of their own",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "set",
+						Description: "Sends alerts about a bot, or bots with a role, to a channel",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:         "channel",
+								Description:  "The channel to send alerts to",
+								Type:         discordgo.ApplicationCommandOptionChannel,
+								ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+								Required:     true,
+							},
+							{
+								Name:        "bot",
+								Description: "The bot to route",
+								Type:        discordgo.ApplicationCommandOptionUser,
+							},
+							{
+								Name:        "role",
+								Description: "Route every bot with this role",
+								Type:        discordgo.ApplicationCommandOptionRole,
+							},
+						},
+					},
+					{
+						Name:        "remove",
+						Description: "Sends alerts about a bot, or bots with a role, back to the default channel",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "bot",
+								Description: "The bot to stop routing",
+								Type:        discordgo.ApplicationCommandOptionUser,
+							},
+							{
+								Name:        "role",
+								Description: "The role to stop routing",
+								Type:        discordgo.ApplicationCommandOptionRole,
+							},
+						},
+					},
+					{
+						Name:        "list",
+						Description: "Lists where alerts go in this server",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+					},
+				},
+			},
 			{
 				Name:        "stats",
 				Description: "Shows stats about OfflineNotifier",
@@ -165,6 +610,66 @@ func main() {
 				Description: "Need help with OfflineNotifier? Join this server!",
 				Type:        discordgo.ChatApplicationCommand,
 			},
+			{
+				Name:                     "template",
+				DefaultMemberPermissions: &channelPermission,
+				DMPermission:             &dmPermission,
+				Description:              "Customizes the alerts sent in a server",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "set",
+						Description: "Sets parts of an alert with text/template, like {{.Bot}} is {{.Status}}",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							templateKindOption,
+							{
+								Name:        "title",
+								Description: "The title, like {{.Bot}} went {{.Status}}",
+								Type:        discordgo.ApplicationCommandOptionString,
+							},
+							{
+								Name:        "description",
+								Description: "The description, \\n starts a new line",
+								Type:        discordgo.ApplicationCommandOptionString,
+							},
+							{
+								Name:        "color",
+								Description: "A hex color like #ff0000",
+								Type:        discordgo.ApplicationCommandOptionString,
+							},
+							{
+								Name:        "footer",
+								Description: "The footer, like Up for {{.Duration}}",
+								Type:        discordgo.ApplicationCommandOptionString,
+							},
+						},
+					},
+					{
+						Name:        "reset",
+						Description: "Goes back to the default alert",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options:     []*discordgo.ApplicationCommandOption{templateKindOption},
+					},
+					{
+						Name:        "preview",
+						Description: "Shows what an alert looks like",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options:     []*discordgo.ApplicationCommandOption{templateKindOption},
+					},
+				},
+			},
+			{
+				Name:        "uptime",
+				Description: "Shows how available a bot has been over the last 90 days",
+				Type:        discordgo.ChatApplicationCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "bot",
+						Description: "The bot to show, leave empty for every bot in the server",
+						Type:        discordgo.ApplicationCommandOptionUser,
+					},
+				},
+			},
 			{
 				Name:                     "watch",
 				DefaultMemberPermissions: &channelPermission,
@@ -181,17 +686,127 @@ func main() {
 						Description: "Stops watching a server",
 						Type:        discordgo.ApplicationCommandOptionSubCommand,
 					},
-				},
-			},
-		}
-	)
-	// INTENTS
-	discord.Identify.Intents = discordgo.IntentsAllWithoutPrivileged | discordgo.IntentGuildMembers | discordgo.IntentGuildPresences
-
-	// open the websocket and begin listening
-	err = discord.Open()
-	if err != nil {
-		log.Fatal("[DISCORDGO] error opening discord session |", err)
+					{
+						Name:        "include",
+						Description: "Always watches a bot, even in explicit mode",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "bot",
+								Description: "The bot to watch",
+								Type:        discordgo.ApplicationCommandOptionUser,
+								Required:    true,
+							},
+						},
+					},
+					{
+						Name:        "exclude",
+						Description: "Never watches a bot",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "bot",
+								Description: "The bot to ignore",
+								Type:        discordgo.ApplicationCommandOptionUser,
+								Required:    true,
+							},
+						},
+					},
+					{
+						Name:        "mode",
+						Description: "Watches every bot that isn't excluded, or only included bots",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "mode",
+								Description: "Which bots to watch",
+								Type:        discordgo.ApplicationCommandOptionString,
+								Required:    true,
+								Choices: []*discordgo.ApplicationCommandOptionChoice{
+									{Name: "every bot", Value: "all"},
+									{Name: "only included bots", Value: "explicit"},
+								},
+							},
+						},
+					},
+					{
+						Name:        "grace",
+						Description: "Sets how long a bot has to stay offline/online before the server is notified",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "seconds",
+								Description: "Seconds to wait, leave empty to reset",
+								Type:        discordgo.ApplicationCommandOptionInteger,
+								MinValue:    &minGracePeriod,
+								MaxValue:    maxGracePeriod,
+							},
+							{
+								Name:        "bot",
+								Description: "Only set it for this bot",
+								Type:        discordgo.ApplicationCommandOptionUser,
+							},
+						},
+					},
+					{
+						Name:        "notify",
+						Description: "Chooses what else the server is notified about, leave empty to see the settings",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "status",
+								Description: "Also notify when a bot switches between online, idle and dnd",
+								Type:        discordgo.ApplicationCommandOptionBoolean,
+							},
+							{
+								Name:        "activity",
+								Description: "Also notify when a bot's activity or custom status changes",
+								Type:        discordgo.ApplicationCommandOptionBoolean,
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:                     "webhook",
+				DefaultMemberPermissions: &channelPermission,
+				DMPermission:             &dmPermission,
+				Description:              "Posts a server's alerts as JSON to a webhook",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "set",
+						Description: "Posts alerts to a URL, signed with a new secret",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Name:        "url",
+								Description: "The https URL to post to",
+								Type:        discordgo.ApplicationCommandOptionString,
+								Required:    true,
+							},
+						},
+					},
+					{
+						Name:        "remove",
+						Description: "Stops posting alerts to the webhook",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+					},
+					{
+						Name:        "test",
+						Description: "Posts a test event to the webhook",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+					},
+				},
+			},
+		}
+	)
+	// INTENTS
+	discord.Identify.Intents = discordgo.IntentsAllWithoutPrivileged | discordgo.IntentGuildMembers | discordgo.IntentGuildPresences
+
+	// open the websocket and begin listening
+	err = discord.Open()
+	if err != nil {
+		log.Fatal("[DISCORDGO] error opening discord session |", err)
 		os.Exit(1)
 	}
 
@@ -213,200 +828,252 @@ func main() {
 	discord.Close()
 }
 
+// ----- SUBCOMMANDS
+
+// runs a one-shot command instead of starting the bot
+func runSubcommand(name string, args []string) {
+	switch name {
+	// import [path] - copies data.json (and history.jsonl) into the sqlite database
+	case "import":
+		path := "data.json"
+		if len(args) > 0 {
+			path = args[0]
+		}
+		sqlite, err := newSqliteStore(sqlitePath())
+		if err != nil {
+			log.Fatal("[IMPORT] error opening sqlite store |", err)
+		}
+		defer sqlite.Close()
+		_, _, err = migrateStore(sqlite)
+		if err != nil {
+			log.Fatal("[IMPORT] error migrating sqlite store |", err)
+		}
+		counts, err := sqlite.importJson(path)
+		if err != nil {
+			log.Fatal("[IMPORT] error importing ", path, " | ", err)
+		}
+		message := fmt.Sprintf("[IMPORT] imported %d bots, %d guilds and %d subscribers from %s into %s", counts[0], counts[1], counts[2], path, sqlitePath())
+		log.Println(message)
+		fmt.Println(message)
+		if _, err = os.Stat(historyPath()); err == nil {
+			count, err := sqlite.importHistory(historyPath())
+			if err != nil {
+				log.Fatal("[IMPORT] error importing ", historyPath(), " | ", err)
+			}
+			message = fmt.Sprintf("[IMPORT] imported %d status events from %s", count, historyPath())
+			log.Println(message)
+			fmt.Println(message)
+		}
+	// migrate - brings the configured store up to the current schema version
+	case "migrate":
+		st, err := openStore()
+		if err != nil {
+			log.Fatal("[MIGRATE] error opening store |", err)
+		}
+		defer st.Close()
+		from, to, err := migrateStore(st)
+		if err != nil {
+			log.Fatal("[MIGRATE] error migrating store |", err)
+		}
+		message := fmt.Sprint("[MIGRATE] store is at schema version ", to)
+		if from != to {
+			message = fmt.Sprint("[MIGRATE] migrated store from schema version ", from, " to ", to)
+		}
+		log.Println(message)
+		fmt.Println(message)
+	default:
+		fmt.Println("unknown subcommand", name)
+		os.Exit(1)
+	}
+}
+
 // ----- EVENTS
 
 // called when discord responds with the ready event
 func ready(s *discordgo.Session, event *discordgo.Ready) {
 	log.Println("[READY]")
-	if !startedCoroutines {
+	startCoroutines.Do(func() {
 		log.Println("[GOLANG] starting coroutines...")
-		requestBotsTicker := time.NewTicker(time.Duration(1) * time.Second)
-		queueHandlerTicker := time.NewTicker(time.Duration(10) * time.Millisecond)
+		requestBotsTicker := time.NewTicker(reconcileInterval())
 		go func() {
+			requestBots(s)
 			for range requestBotsTicker.C {
 				requestBots(s)
 			}
 		}()
+		go queueHandler(s)
 		go func() {
-			for range queueHandlerTicker.C {
-				queueHandler(s)
+			pruneHistory()
+			for range time.Tick(time.Hour) {
+				pruneHistory()
 			}
 		}()
-		startedCoroutines = true
-	}
+		go func() {
+			for range time.Tick(time.Minute) {
+				runDigests(s)
+			}
+		}()
+	})
 }
 
-// called when OfflineNotifier receives GuildMembersChunk
+// called when OfflineNotifier receives GuildMembersChunk, which requestBots
+// asks for as a reconciliation sweep in case a presence update was missed
 func checkOffline(s *discordgo.Session, event *discordgo.GuildMembersChunk) {
-	botMap, err := getJsonBotMap()
-	if err != nil {
-		logMessage(s, "[CHECK OFFLINE] error getting bot map |", err)
-		return
-	}
-
-	guild, err := getJsonGuild(event.GuildID)
+	guild, err := store.GetGuild(event.GuildID)
 	if err != nil {
 		logMessage(s, "[CHECK OFFLINE] error getting json guild |", err)
 		return
 	}
 
 	for _, BID := range guild.Bots {
-		bot, err := s.GuildMember(guild.ID, BID)
-		if err != nil {
-			logMessage(s, "[CHECK OFFLINE] error getting discord bot |", err)
-			continue
-		}
 		currentStatus := "offline"
+		var activities []*discordgo.Activity
 		for _, p := range event.Presences {
 			if p.User.ID == BID {
 				currentStatus = string(p.Status)
+				activities = p.Activities
 			}
 		}
-		if botMap[BID].Status != currentStatus {
-			if botMap[BID].Status == "offline" || currentStatus == "offline" {
-				addToQueue("ss", [4]string{BID, currentStatus, "true"})
-				deltaTime := calculateDeltaTime(botMap[BID].Timestamp)
-				var embed *discordgo.MessageEmbed
-				switch botMap[BID].Status {
-				case "unknown":
-					continue
-				case "offline":
-					// back online
-					embed = &discordgo.MessageEmbed{
-						Title:       (bot.User.Username + " is back online"),
-						Description: "```TOTAL DOWNTIME\n" + deltaTime + "```",
-						Color:       onlineColor,
-						Timestamp:   time.Now().UTC().Format(time.RFC3339),
-					}
-				default:
-					// now offline
-					embed = &discordgo.MessageEmbed{
-						Title:       (bot.User.Username + " is now offline"),
-						Description: "```TOTAL UPTIME\n" + deltaTime + "```",
-						Color:       offlineColor,
-						Timestamp:   time.Now().UTC().Format(time.RFC3339),
-					}
-				}
-				// notify servers
-				for _, GID := range botMap[BID].Guilds {
-					notifyGuild, err := getJsonGuild(GID)
-					if err != nil {
-						log.Println("[CHECK OFFLINE] error getting notify guild |", err)
-						continue
-					}
-					go sendEmbed(s, notifyGuild.CID, embed)
-				}
-				// notify subscribers
-				for _, SID := range botMap[BID].Subscribers {
-					userDM, err := s.UserChannelCreate(SID)
-					if err != nil {
-						log.Println("[CHECK OFFLINE] error creating DM channel |", err)
-						continue
-					}
-					go sendEmbed(s, userDM.ID, embed)
-				}
-			} else {
-				addToQueue("ss", [4]string{BID, currentStatus, "false"})
-			}
+		updateStatus(s, guild.ID, BID, currentStatus)
+		if currentStatus != "offline" {
+			updateActivity(s, guild.ID, BID, activityText(activities))
 		}
 	}
 }
 
-func reaction(s *discordgo.Session, event *discordgo.MessageReactionAdd) {
-	message, err := s.ChannelMessage(event.ChannelID, event.MessageID)
+// called when a member's presence changes in a server
+func presenceUpdate(s *discordgo.Session, event *discordgo.PresenceUpdate) {
+	if event.User == nil {
+		return
+	}
+	bot, err := store.GetBot(event.User.ID)
 	if err != nil {
-		if fmt.Sprintln(err) != "HTTP 403 Forbidden, {\"message\": \"Missing Access\", \"code\": 50001}\n" {
-			logMessage(s, "[REACTION] error getting message |", err)
-		}
+		// not a bot being watched
 		return
 	}
-
-	if message.Author.ID != s.State.User.ID {
+	if _, err = indexID(bot.Guilds, event.GuildID); err != nil {
 		return
 	}
+	updateStatus(s, event.GuildID, bot.ID, string(event.Status))
+	if event.Status != discordgo.StatusOffline {
+		updateActivity(s, event.GuildID, bot.ID, activityText(event.Activities))
+	}
+}
 
-	user, err := s.User(event.UserID)
+// records a bot's current status and hands going offline or coming back
+// online to the alerter, other changes are only sent to those who opted in
+func updateStatus(s *discordgo.Session, GID string, BID string, currentStatus string) {
+	bot, err := store.GetBot(BID)
 	if err != nil {
-		logMessage(s, "[REACTION] error getting discord user |", err)
+		logMessage(s, "[UPDATE STATUS] error getting json bot |", err)
+		return
+	}
+	previousStatus := swapStatus(BID, currentStatus, bot.Status)
+	if previousStatus == currentStatus {
+		return
+	}
+	if previousStatus != "unknown" {
+		recordStatus(BID, previousStatus, currentStatus, bot.Guilds)
+	}
+	if previousStatus != "offline" && currentStatus != "offline" {
+		queueOrLog(s, SetStatus{BID: BID, Status: currentStatus})
+		updateBoards(s, bot)
+		if previousStatus == "unknown" {
+			return
+		}
+		discordBot, err := guildUser(s, GID, BID)
+		if err != nil {
+			logMessage(s, "[UPDATE STATUS] error getting discord bot |", err)
+			return
+		}
+		sendNotice(s, bot, Alert{Kind: "status", BID: BID, Name: discordBot.Username, Status: currentStatus, Previous: previousStatus, Time: time.Now()})
 		return
 	}
 
-	if message.Embeds[0] != nil && user.ID != s.State.User.ID {
-		if strings.Contains(message.Embeds[0].Title, "'s subscriptions") || strings.Contains(message.Embeds[0].Title, "Bots being watched in ") {
-			// get bot list
-			var bots []string
-			if strings.Contains(message.Embeds[0].Title, "'s subscriptions") {
-				// subscriber
-				userName := strings.Replace(message.Embeds[0].Title, "'s subscriptions", "", 1)
-				if user.Username == userName {
-					subscriber, err := getJsonSubscriber(user.ID)
-					if err != nil {
-						logMessage(s, "[REACTION] error getting json subscriber |", err)
-						return
-					}
-					bots = subscriber.Bots
-				} else {
-					return
-				}
-			} else {
-				// guild
-				guild, err := getJsonGuild(event.GuildID)
-				if err != nil {
-					logMessage(s, "[REACTION] error getting json guild |", err)
-					return
-				}
-				bots = guild.Bots
-			}
-
-			// get new page
-			page, err := strconv.Atoi(strings.Split(message.Embeds[0].Footer.Text, "/")[0])
-			if err != nil {
-				logMessage(s, "[REACTION] error converting string to int |", err)
-				return
-			}
-			maxPage := int(math.Ceil(float64(len(bots)) / 9))
-			if event.MessageReaction.Emoji.Name == "➡️" {
-				if page >= maxPage {
-					page = 1
-				} else {
-					page++
-				}
-			} else if event.MessageReaction.Emoji.Name == "⬅" {
-				if page == 1 {
-					page = maxPage
-				} else {
-					page--
-				}
-			}
+	queueOrLog(s, SetStatus{BID: BID, Status: currentStatus, ChangeTimestamp: true, Time: time.Now().Unix()})
+	updateBoards(s, bot)
+	if previousStatus == "unknown" {
+		return
+	}
+	discordBot, err := guildUser(s, GID, BID)
+	if err != nil {
+		logMessage(s, "[UPDATE STATUS] error getting discord bot |", err)
+		return
+	}
+	alerts.change(s, bot, discordBot.Username, previousStatus, currentStatus)
+}
 
-			// update embed
-			embed := message.Embeds[0]
-			embed.Fields = []*discordgo.MessageEmbedField{}
-			embed.Timestamp = time.Now().UTC().Format(time.RFC3339)
-			err = makeBotList(s, embed, bots, page)
-			if err != nil {
-				logMessage(s, "[LIST SUBSCRIBER] error making list |", err)
-				return
-			}
-			s.ChannelMessageEditEmbed(message.ChannelID, message.ID, embed)
-		}
+// sends activity changes of a bot that isn't offline to those who opted in.
+// Activities aren't stored, so the first one seen after a restart is only
+// remembered.
+func updateActivity(s *discordgo.Session, GID string, BID string, activity string) {
+	previousActivity, seen := swapActivity(BID, activity)
+	if !seen || previousActivity == activity {
+		return
+	}
+	bot, err := store.GetBot(BID)
+	if err != nil {
+		return
+	}
+	discordBot, err := guildUser(s, GID, BID)
+	if err != nil {
+		logMessage(s, "[UPDATE ACTIVITY] error getting discord bot |", err)
+		return
 	}
+	sendNotice(s, bot, Alert{Kind: "activity", BID: BID, Name: discordBot.Username, Status: bot.Status, Activity: activity, PreviousActivity: previousActivity, Time: time.Now()})
 }
 
 // ----- COMMANDS
+// board
+// - create
+// - remove
+// deadletter
+// - list
+// - replay [id]
+// - drop [id]
+// digest
+// - schedule [cadence]
+// - now
+// history [bot] [since]
 // invite
 // list
 // - server
 // - subscriptions
+// mention
+// - add [role] [user] [bot]
+// - remove [role] [user] [bot]
+// - recovery [enabled] [bot]
+// - list
 // notify
 // - subscribe [bot]
 // - unsubscribe [bot]
+// - email [address]
+// - verify [code]
+// - settings [status] [activity]
 // privacy
+// route
+// - set [channel] [bot] [role]
+// - remove [bot] [role]
+// - list
 // stats
 // support
+// template
+// - set [alert] [title] [description] [color] [footer]
+// - reset [alert]
+// - preview [alert]
+// uptime [bot]
 // watch
 // - set
 // - stop
+// - include [bot]
+// - exclude [bot]
+// - mode [mode]
+// - grace [seconds] [bot]
+// - notify [status] [activity]
+// webhook
+// - set [url]
+// - remove
+// - test
 
 // receives slash command interactions and runs the respective command
 func commandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
@@ -414,6 +1081,29 @@ func commandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		return
 	}
 	switch i.ApplicationCommandData().Name {
+	case "board":
+		switch i.ApplicationCommandData().Options[0].Name {
+		case "create":
+			createBoard(s, i)
+		case "remove":
+			removeBoard(s, i)
+		}
+	case "deadletter":
+		switch i.ApplicationCommandData().Options[0].Name {
+		case "list":
+			listDeadLetters(s, i)
+		case "replay", "drop":
+			handleDeadLetters(s, i)
+		}
+	case "digest":
+		switch i.ApplicationCommandData().Options[0].Name {
+		case "schedule":
+			scheduleDigest(s, i)
+		case "now":
+			digestNow(s, i)
+		}
+	case "history":
+		showHistory(s, i)
 	case "invite":
 		invite(s, i)
 	case "list":
@@ -423,131 +1113,383 @@ func commandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		case "subscriptions":
 			listSubscriptions(s, i)
 		}
+	case "mention":
+		switch i.ApplicationCommandData().Options[0].Name {
+		case "add", "remove":
+			mention(s, i)
+		case "recovery":
+			mentionRecovery(s, i)
+		case "list":
+			listMentions(s, i)
+		}
 	case "notify":
 		switch i.ApplicationCommandData().Options[0].Name {
 		case "subscribe":
 			subscribe(s, i)
 		case "unsubscribe":
 			unsubscribe(s, i)
+		case "email":
+			setEmail(s, i)
+		case "verify":
+			verifyEmail(s, i)
+		case "settings":
+			notifySettings(s, i)
 		}
 	case "privacy":
 		privacy(s, i)
+	case "route":
+		switch i.ApplicationCommandData().Options[0].Name {
+		case "set", "remove":
+			route(s, i)
+		case "list":
+			listRoutes(s, i)
+		}
 	case "stats":
 		stats(s, i)
 	case "support":
 		support(s, i)
+	case "template":
+		switch i.ApplicationCommandData().Options[0].Name {
+		case "set", "reset":
+			setTemplate(s, i)
+		case "preview":
+			previewTemplate(s, i)
+		}
+	case "uptime":
+		uptime(s, i)
 	case "watch":
 		switch i.ApplicationCommandData().Options[0].Name {
 		case "set":
 			set(s, i)
 		case "stop":
 			stop(s, i)
+		case "include", "exclude":
+			watchList(s, i)
+		case "mode":
+			watchMode(s, i)
+		case "grace":
+			grace(s, i)
+		case "notify":
+			notifySettings(s, i)
 		}
-	}
-}
-
-// sets the channel that OfflineNotifier will use
-func set(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	var embed []*discordgo.MessageEmbed
-	addToQueue("ac", [4]string{i.GuildID, i.ChannelID})
-	embed = []*discordgo.MessageEmbed{
-		{
-			Title: "Set channel request successful",
-			Color: successColor,
-		},
-	}
-	responseData := &discordgo.InteractionResponseData{Embeds: embed}
-	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
-	go s.InteractionRespond(i.Interaction, response)
-}
-
-// sends an invite link for the bot
-func invite(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	embed := []*discordgo.MessageEmbed{
-		{
-			Title: "Want OfflineNotifier in your server? Use this link!",
-			URL:   inviteLink,
-			Color: defaultColor,
-		},
-	}
-	responseData := &discordgo.InteractionResponseData{Embeds: embed}
-	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
-	go s.InteractionRespond(i.Interaction, response)
-}
-
-// lists the bots being watched in this server
-func listServer(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	// check if in a server
-	if i.GuildLocale == nil {
-		embed := []*discordgo.MessageEmbed{
-			{
-				Title:       "List server failed",
-				Description: "You're not in a server",
-				Color:       failColor,
-			},
+	case "webhook":
+		switch i.ApplicationCommandData().Options[0].Name {
+		case "set", "remove":
+			setWebhook(s, i)
+		case "test":
+			testWebhook(s, i)
 		}
-		responseData := &discordgo.InteractionResponseData{Embeds: embed}
-		response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
-		go s.InteractionRespond(i.Interaction, response)
-		return
 	}
+}
 
-	// get guild
-	discordGuild, err := s.Guild(i.GuildID)
-	if err != nil {
-		logMessage(s, "[LIST SERVER] error getting discord guild |", err)
-		return
-	}
-	guild, err := getJsonGuild(discordGuild.ID)
+// posts the server's status board in the channel, replacing any older one
+func createBoard(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	guild, err := store.GetGuild(i.GuildID)
 	if err != nil {
-		embeds := []*discordgo.MessageEmbed{
-			{
-				Title: "Bots aren't being watched in " + discordGuild.Name,
-				Color: failColor,
-			},
-		}
-		responseData := &discordgo.InteractionResponseData{Embeds: embeds}
+		embed := []*discordgo.MessageEmbed{{
+			Title:       "Create board request failed",
+			Description: "This server isn't being watched, use /watch set first",
+			Color:       failColor,
+		}}
+		responseData := &discordgo.InteractionResponseData{Embeds: embed}
 		response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
 		go s.InteractionRespond(i.Interaction, response)
 		return
 	}
 
-	// make placeholder embed
+	// placeholder, only shown to whoever asked so the board stays on its own
 	embeds := []*discordgo.MessageEmbed{
 		{
-			Title: "Loading bots...",
+			Title: "Creating board...",
 			Color: defaultColor,
 		},
 	}
-	data := &discordgo.InteractionResponseData{Embeds: embeds}
+	data := &discordgo.InteractionResponseData{Embeds: embeds, Flags: discordgo.MessageFlagsEphemeral}
 	response := &discordgo.InteractionResponse{Type: 4, Data: data}
 	go s.InteractionRespond(i.Interaction, response)
 
-	// make embed
-	embeds = []*discordgo.MessageEmbed{
-		{
-			Title:     "Bots being watched in " + discordGuild.Name,
-			Color:     defaultColor,
-			Timestamp: time.Now().UTC().Format(time.RFC3339),
-		},
-	}
-	err = makeBotList(s, embeds[0], guild.Bots, 1)
+	old := guild.Settings.Board
+	_, err = postBoard(s, guild, i.ChannelID)
 	if err != nil {
-		logMessage(s, "[LIST SERVER] error making list |", err)
-		return
+		logMessage(s, "[CREATE BOARD] error posting board |", err)
+		embeds = []*discordgo.MessageEmbed{{
+			Title:       "Create board request failed",
+			Description: "Couldn't post the board, check OfflineNotifier can send messages here",
+			Color:       failColor,
+		}}
+	} else {
+		if old.MID != "" {
+			s.ChannelMessageDelete(old.CID, old.MID)
+		}
+		embeds = []*discordgo.MessageEmbed{{
+			Title:       "Create board request successful",
+			Description: "The board is kept up to date as bots change status",
+			Color:       successColor,
+		}}
 	}
 	edit := &discordgo.WebhookEdit{Embeds: &embeds}
-	message, err := s.InteractionResponseEdit(i.Interaction, edit)
+	_, err = s.InteractionResponseEdit(i.Interaction, edit)
 	if err != nil {
-		logMessage(s, "[LIST SERVER] error editing response |", err)
-		return
+		logMessage(s, "[CREATE BOARD] error editing response |", err)
 	}
-	s.MessageReactionAdd(message.ChannelID, message.ID, "⬅")
-	s.MessageReactionAdd(message.ChannelID, message.ID, "➡️")
 }
 
-// lists the bots being watched by a subscriber
-func listSubscriptions(s *discordgo.Session, i *discordgo.InteractionCreate) {
+// deletes the server's status board
+func removeBoard(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var embed []*discordgo.MessageEmbed
+	guild, err := store.GetGuild(i.GuildID)
+	if err != nil || guild.Settings.Board.MID == "" {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Remove board request failed",
+			Description: "This server doesn't have a board, use /board create first",
+			Color:       failColor,
+		}}
+	} else if err = addToQueue(SetBoard{GID: i.GuildID}); err != nil {
+		logMessage(s, "[REMOVE BOARD] error queueing request |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Remove board request failed",
+			Description: "Couldn't save your request, try again later",
+			Color:       failColor,
+		}}
+	} else {
+		// it's fine if someone already deleted it
+		s.ChannelMessageDelete(guild.Settings.Board.CID, guild.Settings.Board.MID)
+		embed = []*discordgo.MessageEmbed{{
+			Title: "Remove board request successful",
+			Color: successColor,
+		}}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// lists the newest dead letters, for the owner only
+func listDeadLetters(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var embed []*discordgo.MessageEmbed
+	letters, err := deadLetters.List()
+	if !fromOwner(i) {
+		embed = ownerOnlyEmbed("List dead letters failed")
+	} else if err != nil {
+		logMessage(s, "[DEAD LETTERS] error listing dead letters |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "List dead letters failed",
+			Description: "Couldn't read the dead letters, try again later",
+			Color:       failColor,
+		}}
+	} else {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Dead letters",
+			Description: "Nothing failed to deliver",
+			Color:       defaultColor,
+		}}
+		if len(letters) > 0 {
+			embed[0].Description = fmt.Sprintf("%d alerts couldn't be delivered, use /deadletter replay or /deadletter drop", len(letters))
+		}
+		for n := len(letters) - 1; n >= 0 && len(embed[0].Fields) < maxDeadLettersListed; n-- {
+			letter := letters[n]
+			to := "server " + letter.GID
+			if letter.SID != "" {
+				to = "<@" + letter.SID + ">"
+			}
+			reason := letter.Error
+			if len(reason) > 200 {
+				reason = reason[:200] + "..."
+			}
+			embed[0].Fields = append(embed[0].Fields, &discordgo.MessageEmbedField{
+				Name:  fmt.Sprintf("#%d %s %s", letter.ID, letter.Alert.Name, letter.Alert.Kind),
+				Value: fmt.Sprintf("<t:%d:f> %s to %s, %d attempts```%s```", letter.Time, letter.Channel, to, letter.Attempts, reason),
+			})
+		}
+		if len(letters) > maxDeadLettersListed {
+			embed[0].Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Showing the newest %d of %d", maxDeadLettersListed, len(letters))}
+		}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed, Flags: discordgo.MessageFlagsEphemeral}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// replays or drops one dead letter, or all of them, for the owner only
+func handleDeadLetters(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	subcommand := i.ApplicationCommandData().Options[0]
+	title := "Replay dead letters"
+	if subcommand.Name == "drop" {
+		title = "Drop dead letters"
+	}
+
+	var embed []*discordgo.MessageEmbed
+	var letters []DeadLetter
+	var err error
+	if len(subcommand.Options) > 0 {
+		var letter DeadLetter
+		letter, err = deadLetters.Get(subcommand.Options[0].IntValue())
+		letters = []DeadLetter{letter}
+	} else {
+		letters, err = deadLetters.List()
+	}
+	if !fromOwner(i) {
+		embed = ownerOnlyEmbed(title + " failed")
+	} else if err == errDeadLetterNotFound {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       title + " failed",
+			Description: "There's no dead letter with that ID",
+			Color:       failColor,
+		}}
+	} else if err != nil {
+		logMessage(s, "[DEAD LETTERS] error getting dead letters |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       title + " failed",
+			Description: "Couldn't read the dead letters, try again later",
+			Color:       failColor,
+		}}
+	} else {
+		done := 0
+		var failures []string
+		for _, letter := range letters {
+			if subcommand.Name == "drop" {
+				err = deadLetters.Remove(letter.ID)
+			} else {
+				err = replayDeadLetter(s, letter)
+			}
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("#%d %s", letter.ID, err))
+				continue
+			}
+			done++
+		}
+		description := fmt.Sprintf("Replaying %d dead letters, the ones that fail again come back with new IDs", done)
+		if subcommand.Name == "drop" {
+			description = fmt.Sprintf("Dropped %d dead letters", done)
+		}
+		if len(failures) > 0 {
+			description += "```" + strings.Join(failures, "\n") + "```"
+			if len(description) > 4000 {
+				description = description[:3990] + "...```"
+			}
+		}
+		embed = []*discordgo.MessageEmbed{{
+			Title:       title,
+			Description: description,
+			Color:       successColor,
+		}}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed, Flags: discordgo.MessageFlagsEphemeral}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// sets the channel that OfflineNotifier will use
+func set(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var embed []*discordgo.MessageEmbed
+	err := addToQueue(AssignChannel{GID: i.GuildID, CID: i.ChannelID})
+	if err != nil {
+		logMessage(s, "[SET] error queueing request |", err)
+		embed = []*discordgo.MessageEmbed{
+			{
+				Title:       "Set channel request failed",
+				Description: "Couldn't save your request, try again later",
+				Color:       failColor,
+			},
+		}
+	} else {
+		embed = []*discordgo.MessageEmbed{
+			{
+				Title: "Set channel request successful",
+				Color: successColor,
+			},
+		}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// sends an invite link for the bot
+func invite(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	embed := []*discordgo.MessageEmbed{
+		{
+			Title: "Want OfflineNotifier in your server? Use this link!",
+			URL:   inviteLink,
+			Color: defaultColor,
+		},
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// lists the bots being watched in this server
+func listServer(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// check if in a server
+	if i.GuildLocale == nil {
+		embed := []*discordgo.MessageEmbed{
+			{
+				Title:       "List server failed",
+				Description: "You're not in a server",
+				Color:       failColor,
+			},
+		}
+		responseData := &discordgo.InteractionResponseData{Embeds: embed}
+		response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+		go s.InteractionRespond(i.Interaction, response)
+		return
+	}
+
+	// get guild
+	discordGuild, err := s.Guild(i.GuildID)
+	if err != nil {
+		logMessage(s, "[LIST SERVER] error getting discord guild |", err)
+		return
+	}
+	guild, err := store.GetGuild(discordGuild.ID)
+	if err != nil {
+		embeds := []*discordgo.MessageEmbed{
+			{
+				Title: "Bots aren't being watched in " + discordGuild.Name,
+				Color: failColor,
+			},
+		}
+		responseData := &discordgo.InteractionResponseData{Embeds: embeds}
+		response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+		go s.InteractionRespond(i.Interaction, response)
+		return
+	}
+
+	// make placeholder embed
+	embeds := []*discordgo.MessageEmbed{
+		{
+			Title: "Loading bots...",
+			Color: defaultColor,
+		},
+	}
+	data := &discordgo.InteractionResponseData{Embeds: embeds}
+	response := &discordgo.InteractionResponse{Type: 4, Data: data}
+	go s.InteractionRespond(i.Interaction, response)
+
+	// make embed
+	embeds = []*discordgo.MessageEmbed{
+		{
+			Title:     "Bots being watched in " + discordGuild.Name,
+			Color:     defaultColor,
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+	err = makeBotList(s, embeds[0], guild.Bots, 1)
+	if err != nil {
+		logMessage(s, "[LIST SERVER] error making list |", err)
+		return
+	}
+	components := pageButtons("server", discordGuild.ID, 1, pageCount(len(guild.Bots), botsPerPage))
+	edit := &discordgo.WebhookEdit{Embeds: &embeds, Components: &components}
+	_, err = s.InteractionResponseEdit(i.Interaction, edit)
+	if err != nil {
+		logMessage(s, "[LIST SERVER] error editing response |", err)
+	}
+}
+
+// lists the bots being watched by a subscriber
+func listSubscriptions(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	// get subscriber
 	var user *discordgo.User
 	if i.User != nil {
@@ -555,8 +1497,8 @@ func listSubscriptions(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	} else {
 		user = i.Member.User
 	}
-	subscriber, err := getJsonSubscriber(user.ID)
-	if err != nil {
+	subscriber, err := store.GetSubscriber(user.ID)
+	if err != nil || len(subscriber.Bots) == 0 {
 		embeds := []*discordgo.MessageEmbed{
 			{
 				Title: "You're not subscribed to any bots!",
@@ -593,14 +1535,12 @@ func listSubscriptions(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		logMessage(s, "[LIST SUBSCRIBER] error making list |", err)
 		return
 	}
-	edit := &discordgo.WebhookEdit{Embeds: &embeds}
-	message, err := s.InteractionResponseEdit(i.Interaction, edit)
+	components := pageButtons("subscriptions", user.ID, 1, pageCount(len(subscriber.Bots), botsPerPage))
+	edit := &discordgo.WebhookEdit{Embeds: &embeds, Components: &components}
+	_, err = s.InteractionResponseEdit(i.Interaction, edit)
 	if err != nil {
 		logMessage(s, "[LIST SUBSCRIBER] error editing response |", err)
-		return
 	}
-	s.MessageReactionAdd(message.ChannelID, message.ID, "⬅")
-	s.MessageReactionAdd(message.ChannelID, message.ID, "➡️")
 }
 
 // sends OfflineNotifier's privacy policy
@@ -608,7 +1548,7 @@ func privacy(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	embed := []*discordgo.MessageEmbed{
 		{
 			Title:       "Privacy policy",
-			Description: "```Data is never shared with anyone and is only ever used within the bot. OfflineNotifier stores the IDs of users, bots, servers, and channels along with bots' current online/offline status. We uses this data to track a bot's status and to send a notification in the right server and channel. We only store the user IDs of people subscribed to bots. To remove your user ID, unsubscribe from all bots. To remove your server's info, use /watch stop. Questions? Join the server at /support.```",
+			Description: "```Data is never shared with anyone and is only ever used within the bot. OfflineNotifier stores the IDs of users, bots, servers, and channels along with bots' current online/offline status. We uses this data to track a bot's status and to send a notification in the right server and channel. We only store the user IDs of people subscribed to bots, and the email address of subscribers who add one with /notify email. To remove your user ID, unsubscribe from all bots. To remove your server's info, use /watch stop. Questions? Join the server at /support.```",
 			Color:       defaultColor,
 		},
 	}
@@ -621,7 +1561,7 @@ func privacy(s *discordgo.Session, i *discordgo.InteractionCreate) {
 func stats(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	// calculate totals
 	totalServers := int64(len(s.State.Guilds))
-	guilds, err := getJsonGuildMap()
+	guilds, err := store.ListGuilds()
 	if err != nil {
 		logMessage(s, "[STATS] error getting guild map |", err)
 		return
@@ -659,306 +1599,1482 @@ func stats(s *discordgo.Session, i *discordgo.InteractionCreate) {
 // stops watching a server
 func stop(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	var embed []*discordgo.MessageEmbed
-	addToQueue("rg", [4]string{i.GuildID})
-	embed = []*discordgo.MessageEmbed{
-		{
-			Title: "Stop request successful",
-			Color: successColor,
-		},
+	guild, guildErr := store.GetGuild(i.GuildID)
+	err := addToQueue(RemoveGuild{GID: i.GuildID})
+	if err != nil {
+		logMessage(s, "[STOP] error queueing request |", err)
+		embed = []*discordgo.MessageEmbed{
+			{
+				Title:       "Stop request failed",
+				Description: "Couldn't save your request, try again later",
+				Color:       failColor,
+			},
+		}
+	} else {
+		embed = []*discordgo.MessageEmbed{
+			{
+				Title: "Stop request successful",
+				Color: successColor,
+			},
+		}
+		// nothing keeps the board up to date anymore
+		if board := guild.Settings.Board; guildErr == nil && board.MID != "" {
+			go s.ChannelMessageDelete(board.CID, board.MID)
+		}
 	}
 	responseData := &discordgo.InteractionResponseData{Embeds: embed}
 	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
 	go s.InteractionRespond(i.Interaction, response)
 }
 
-// subscribes to a bot
-func subscribe(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	BID := i.ApplicationCommandData().Options[0].Options[0].Value.(string)
-	UID := i.Member.User.ID
+// includes or excludes a bot
+func watchList(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	subcommand := i.ApplicationCommandData().Options[0]
+	BID := subcommand.Options[0].Value.(string)
+	action := SetWatchList{GID: i.GuildID, BID: BID, Exclude: subcommand.Name == "exclude"}
 
 	var embed []*discordgo.MessageEmbed
-	discordBot, err := s.GuildMember(i.GuildID, BID)
+	var user *discordgo.User
+	if resolved := i.ApplicationCommandData().Resolved; resolved != nil {
+		user = resolved.Users[BID]
+	}
+	_, err := store.GetGuild(i.GuildID)
 	if err != nil {
-		logMessage(s, "[SUBSCRIBE] error getting discord bot |", err)
 		embed = []*discordgo.MessageEmbed{{
-			Title:       "Subscribe request failed",
-			Description: "Error finding bot!",
+			Title:       "Watch list request failed",
+			Description: "This server isn't being watched, use /watch set first",
+			Color:       failColor,
+		}}
+	} else if user == nil || !user.Bot || BID == s.State.User.ID {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Watch list request failed",
+			Description: "<@" + BID + "> is not a valid bot!",
+			Color:       failColor,
+		}}
+	} else if err = addToQueue(action); err != nil {
+		logMessage(s, "[WATCH LIST] error queueing request |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Watch list request failed",
+			Description: "Couldn't save your request, try again later",
+			Color:       failColor,
+		}}
+	} else {
+		scheduleBoard(s, i.GuildID)
+		description := user.Username + " is always watched"
+		if action.Exclude {
+			description = user.Username + " is never watched"
+		}
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Watch list request successful",
+			Description: description,
+			Color:       successColor,
+		}}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// switches between watching every bot and only included bots
+func watchMode(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	explicitOnly := i.ApplicationCommandData().Options[0].Options[0].Value.(string) == "explicit"
+
+	var embed []*discordgo.MessageEmbed
+	_, err := store.GetGuild(i.GuildID)
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Watch mode request failed",
+			Description: "This server isn't being watched, use /watch set first",
+			Color:       failColor,
+		}}
+	} else if err = addToQueue(SetExplicitOnly{GID: i.GuildID, ExplicitOnly: explicitOnly}); err != nil {
+		logMessage(s, "[WATCH MODE] error queueing request |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Watch mode request failed",
+			Description: "Couldn't save your request, try again later",
+			Color:       failColor,
+		}}
+	} else {
+		scheduleBoard(s, i.GuildID)
+		description := "Watching every bot that isn't excluded"
+		if explicitOnly {
+			description = "Only watching bots added with /watch include"
+		}
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Watch mode request successful",
+			Description: description,
+			Color:       successColor,
+		}}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// sets the grace period of the server or of one of its bots
+func grace(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	action := SetGracePeriod{GID: i.GuildID, Clear: true}
+	for _, option := range i.ApplicationCommandData().Options[0].Options {
+		switch option.Name {
+		case "seconds":
+			action.Seconds = option.IntValue()
+			action.Clear = false
+		case "bot":
+			action.BID = option.Value.(string)
+		}
+	}
+
+	var embed []*discordgo.MessageEmbed
+	_, err := store.GetGuild(i.GuildID)
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Grace period request failed",
+			Description: "This server isn't being watched, use /watch set first",
+			Color:       failColor,
+		}}
+	} else if err = addToQueue(action); err != nil {
+		logMessage(s, "[GRACE] error queueing request |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Grace period request failed",
+			Description: "Couldn't save your request, try again later",
+			Color:       failColor,
+		}}
+	} else {
+		description := "Notifying as soon as bots go offline/come back online"
+		if action.Seconds > 0 {
+			description = "Waiting " + formatDuration(time.Duration(action.Seconds)*time.Second) + " before notifying"
+		}
+		if action.BID != "" {
+			if action.Clear {
+				description = "<@" + action.BID + "> uses the server's grace period again"
+			} else {
+				description += " about <@" + action.BID + ">"
+			}
+		}
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Grace period request successful",
+			Description: description,
+			Color:       successColor,
+		}}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// shows or changes the opt-in alerts of the server (/watch notify) or of the
+// user (/notify settings)
+func notifySettings(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	action := SetNotify{GID: i.GuildID}
+	if i.ApplicationCommandData().Name == "notify" {
+		action = SetNotify{SID: i.Member.User.ID}
+	}
+	for _, option := range i.ApplicationCommandData().Options[0].Options {
+		value := option.BoolValue()
+		switch option.Name {
+		case "status":
+			action.Status = &value
+		case "activity":
+			action.Activity = &value
+		}
+	}
+
+	var embed []*discordgo.MessageEmbed
+	var notify NotifySettings
+	var err error
+	if action.SID != "" {
+		var subscriber Subscriber
+		subscriber, err = store.GetSubscriber(action.SID)
+		notify = subscriber.Settings.Notify
+		if err != nil {
+			embed = []*discordgo.MessageEmbed{{
+				Title:       "Notify settings request failed",
+				Description: "You aren't subscribed to any bots, use /notify subscribe first",
+				Color:       failColor,
+			}}
+		}
+	} else {
+		var guild Guild
+		guild, err = store.GetGuild(action.GID)
+		notify = guild.Settings.Notify
+		if err != nil {
+			embed = []*discordgo.MessageEmbed{{
+				Title:       "Notify settings request failed",
+				Description: "This server isn't being watched, use /watch set first",
+				Color:       failColor,
+			}}
+		}
+	}
+	if err == nil && (action.Status != nil || action.Activity != nil) {
+		err = addToQueue(action)
+		if err != nil {
+			logMessage(s, "[NOTIFY SETTINGS] error queueing request |", err)
+			embed = []*discordgo.MessageEmbed{{
+				Title:       "Notify settings request failed",
+				Description: "Couldn't save your request, try again later",
+				Color:       failColor,
+			}}
+		}
+	}
+	if err == nil {
+		notify = action.merge(notify)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Notify settings",
+			Description: "```STATUS CHANGES\n" + onOff(notify.Status) + "\n-----------\nACTIVITY CHANGES\n" + onOff(notify.Activity) + "```",
+			Color:       successColor,
+		}}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// sends a verification code to a subscriber's address, or stops emails
+func setEmail(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	SID := i.Member.User.ID
+	action := SetEmail{SID: SID}
+	for _, option := range i.ApplicationCommandData().Options[0].Options {
+		action.Address = option.Value.(string)
+	}
+
+	var embed []*discordgo.MessageEmbed
+	respond := func() {
+		responseData := &discordgo.InteractionResponseData{Embeds: embed, Flags: discordgo.MessageFlagsEphemeral}
+		response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+		go s.InteractionRespond(i.Interaction, response)
+	}
+	subscriber, err := store.GetSubscriber(SID)
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Email request failed",
+			Description: "You aren't subscribed to any bots, use /notify subscribe first",
+			Color:       failColor,
+		}}
+		respond()
+		return
+	}
+
+	// no address stops emails
+	if action.Address == "" {
+		err = addToQueue(action)
+		if err != nil {
+			logMessage(s, "[EMAIL] error queueing request |", err)
+			embed = []*discordgo.MessageEmbed{{
+				Title:       "Email request failed",
+				Description: "Couldn't save your request, try again later",
+				Color:       failColor,
+			}}
+		} else {
+			embed = []*discordgo.MessageEmbed{{
+				Title:       "Email request successful",
+				Description: "Alerts won't be emailed to you anymore",
+				Color:       successColor,
+			}}
+		}
+		respond()
+		return
+	}
+
+	if _, enabled := loadSmtpConfig(); !enabled {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Email request failed",
+			Description: "Email isn't set up for this bot",
+			Color:       failColor,
+		}}
+		respond()
+		return
+	}
+	action.Address, err = parseEmail(action.Address)
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Email request failed",
+			Description: "That isn't a valid email address",
+			Color:       failColor,
+		}}
+		respond()
+		return
+	}
+	if time.Since(time.Unix(subscriber.Settings.Email.CodeSent, 0)) < emailCodeCooldown {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Email request failed",
+			Description: "A code was just sent, wait a minute before asking for another one",
+			Color:       failColor,
+		}}
+		respond()
+		return
+	}
+
+	// placeholder while the email is sent
+	embed = []*discordgo.MessageEmbed{{
+		Title: "Sending code...",
+		Color: defaultColor,
+	}}
+	respond()
+
+	code, err := newEmailCode()
+	if err == nil {
+		err = sendEmailCode(action.Address, code)
+		if err != nil {
+			log.Println("[EMAIL] error sending verification code |", err)
+			embed = []*discordgo.MessageEmbed{{
+				Title:       "Email request failed",
+				Description: "Couldn't send an email to " + action.Address + ", check the address and try again later",
+				Color:       failColor,
+			}}
+		}
+	}
+	if err == nil {
+		action.CodeHash = hashEmailCode(code)
+		action.CodeSent = time.Now().Unix()
+		err = addToQueue(action)
+		if err != nil {
+			logMessage(s, "[EMAIL] error queueing request |", err)
+			embed = []*discordgo.MessageEmbed{{
+				Title:       "Email request failed",
+				Description: "Couldn't save your request, try again later",
+				Color:       failColor,
+			}}
+		} else {
+			resetEmailAttempts(SID)
+			embed = []*discordgo.MessageEmbed{{
+				Title:       "Email request successful",
+				Description: "A code was sent to " + action.Address + ", use /notify verify within an hour to start getting alerts there",
+				Color:       successColor,
+			}}
+		}
+	}
+	edit := &discordgo.WebhookEdit{Embeds: &embed}
+	_, err = s.InteractionResponseEdit(i.Interaction, edit)
+	if err != nil {
+		logMessage(s, "[EMAIL] error editing response |", err)
+	}
+}
+
+// confirms a subscriber's address with the code sent to it
+func verifyEmail(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	SID := i.Member.User.ID
+	code := i.ApplicationCommandData().Options[0].Options[0].Value.(string)
+
+	var embed []*discordgo.MessageEmbed
+	subscriber, err := store.GetSubscriber(SID)
+	email := subscriber.Settings.Email
+	if err == nil {
+		err = checkEmailCode(SID, email, code, time.Now())
+	}
+	switch {
+	case err == errEmailCodeExpired:
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Verify request failed",
+			Description: "The code expired, use /notify email to get a new one",
+			Color:       failColor,
+		}}
+	case err == errEmailCodeWrong:
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Verify request failed",
+			Description: "That code isn't right",
+			Color:       failColor,
+		}}
+	case err != nil:
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Verify request failed",
+			Description: "There's no code to verify, use /notify email first",
+			Color:       failColor,
+		}}
+	default:
+		err = addToQueue(VerifyEmail{SID: SID, Address: email.Address})
+		if err != nil {
+			logMessage(s, "[VERIFY EMAIL] error queueing request |", err)
+			embed = []*discordgo.MessageEmbed{{
+				Title:       "Verify request failed",
+				Description: "Couldn't save your request, try again later",
+				Color:       failColor,
+			}}
+		} else {
+			embed = []*discordgo.MessageEmbed{{
+				Title:       "Verify request successful",
+				Description: "Alerts about your subscriptions will also be emailed to " + email.Address,
+				Color:       successColor,
+			}}
+		}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed, Flags: discordgo.MessageFlagsEphemeral}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// subscribes to a bot
+func subscribe(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	BID := i.ApplicationCommandData().Options[0].Options[0].Value.(string)
+	UID := i.Member.User.ID
+
+	var embed []*discordgo.MessageEmbed
+	discordBot, err := s.GuildMember(i.GuildID, BID)
+	if err != nil {
+		logMessage(s, "[SUBSCRIBE] error getting discord bot |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Subscribe request failed",
+			Description: "Error finding bot!",
+			Color:       failColor,
+		}}
+	} else {
+		if discordBot.User.Bot && BID != s.State.User.ID {
+			err = addToQueue(AddSubscriber{SID: UID, BID: BID})
+			if err != nil {
+				logMessage(s, "[SUBSCRIBE] error queueing request |", err)
+				embed = []*discordgo.MessageEmbed{{
+					Title:       "Subscribe request failed",
+					Description: "Couldn't save your request, try again later",
+					Color:       failColor,
+				}}
+			} else {
+				embed = []*discordgo.MessageEmbed{{
+					Title:       "Subscribe request successful",
+					Description: "You are now subscribed to " + discordBot.User.Username,
+					Color:       successColor,
+				}}
+			}
+		} else {
+			embed = []*discordgo.MessageEmbed{{
+				Title:       "Subscribe request failed",
+				Description: discordBot.User.Username + " is not a valid bot!",
+				Color:       failColor,
+			}}
+		}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// support - sends a server invite for nooby's bot sanctuary
+func support(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	embed := []*discordgo.MessageEmbed{{
+		Title: "Need help with OfflineNotifier? Join this server!",
+		URL:   "https://discord.gg/YDRKdkh",
+		Color: defaultColor,
+	}}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// unsubscribes from a bot
+func unsubscribe(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	BID := i.ApplicationCommandData().Options[0].Options[0].Value.(string)
+	UID := i.Member.User.ID
+
+	embed := []*discordgo.MessageEmbed{{
+		Title: "Unsubscribe request successful!",
+		Color: successColor,
+	}}
+	err := addToQueue(RemoveSubscriber{SID: UID, BID: BID})
+	if err != nil {
+		logMessage(s, "[UNSUBSCRIBE] error queueing request |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Unsubscribe request failed",
+			Description: "Couldn't save your request, try again later",
+			Color:       failColor,
+		}}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// sets how often the server gets a digest
+func scheduleDigest(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	cadence := i.ApplicationCommandData().Options[0].Options[0].Value.(string)
+	if cadence == "off" {
+		cadence = ""
+	}
+
+	var embed []*discordgo.MessageEmbed
+	_, err := store.GetGuild(i.GuildID)
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Digest schedule request failed",
+			Description: "This server isn't being watched, use /watch set first",
+			Color:       failColor,
+		}}
+	} else if err = addToQueue(SetDigest{GID: i.GuildID, Cadence: cadence, Time: time.Now().Unix()}); err != nil {
+		logMessage(s, "[DIGEST] error queueing request |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Digest schedule request failed",
+			Description: "Couldn't save your request, try again later",
+			Color:       failColor,
+		}}
+	} else {
+		description := "Digests turned off"
+		if cadence != "" {
+			description = fmt.Sprintf("Posting a %s digest, the first one <t:%d:R>", cadence, digestNextPeriod(cadence, time.Now()).Unix())
+		}
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Digest schedule request successful",
+			Description: description,
+			Color:       successColor,
+		}}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// posts a digest of the last 7 days in reply
+func digestNow(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	guild, err := store.GetGuild(i.GuildID)
+	if err != nil {
+		embed := []*discordgo.MessageEmbed{{
+			Title:       "Digest request failed",
+			Description: "This server isn't being watched, use /watch set first",
+			Color:       failColor,
+		}}
+		responseData := &discordgo.InteractionResponseData{Embeds: embed}
+		response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+		go s.InteractionRespond(i.Interaction, response)
+		return
+	}
+
+	// make placeholder embed
+	embed := []*discordgo.MessageEmbed{{
+		Title: "Loading digest...",
+		Color: defaultColor,
+	}}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	err = s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		logMessage(s, "[DIGEST] error responding |", err)
+		return
+	}
+
+	end := time.Now()
+	message, err := makeDigest(s, guild, end.AddDate(0, 0, -7), end)
+	if err != nil {
+		logMessage(s, "[DIGEST] error making digest |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Digest request failed",
+			Description: "Couldn't read the bots' history, try again later",
+			Color:       failColor,
+		}}
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Embeds: &embed})
+		return
+	}
+	edit := &discordgo.WebhookEdit{Embeds: &message.Embeds, Files: message.Files}
+	_, err = s.InteractionResponseEdit(i.Interaction, edit)
+	if err != nil {
+		logMessage(s, "[DIGEST] error editing response |", err)
+	}
+}
+
+// lists a bot's offline periods since a while ago, a week by default
+func showHistory(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var BID string
+	since := 7 * 24 * time.Hour
+	var err error
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "bot":
+			BID = option.Value.(string)
+		case "since":
+			since, err = parseSince(option.Value.(string))
+		}
+	}
+
+	var embed []*discordgo.MessageEmbed
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "History request failed",
+			Description: "Couldn't understand since, try something like 12h, 7d or 2w",
+			Color:       failColor,
+		}}
+		responseData := &discordgo.InteractionResponseData{Embeds: embed}
+		response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+		go s.InteractionRespond(i.Interaction, response)
+		return
+	}
+	bot, err := store.GetBot(BID)
+	if err != nil || !visibleBot(i, bot) {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "History request failed",
+			Description: notVisible(i, BID),
+			Color:       failColor,
+		}}
+		responseData := &discordgo.InteractionResponseData{Embeds: embed}
+		response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+		go s.InteractionRespond(i.Interaction, response)
+		return
+	}
+	events, err := history.Events(BID, time.Unix(0, 0))
+	if err != nil {
+		logMessage(s, "[HISTORY] error getting history |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "History request failed",
+			Description: "Couldn't read the bot's history, try again later",
+			Color:       failColor,
+		}}
+		responseData := &discordgo.InteractionResponseData{Embeds: embed}
+		response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+		go s.InteractionRespond(i.Interaction, response)
+		return
+	}
+
+	name := "<@" + BID + ">"
+	if discordBot, err := botUser(s, i.GuildID, BID); err == nil {
+		name = discordBot.Username
+	}
+	now := time.Now()
+	sinceTime := now.Add(-since)
+	spans := outages(bot, events, sinceTime, now)
+	embed = []*discordgo.MessageEmbed{{
+		Title:       name + "'s outages",
+		Description: fmt.Sprintf("Offline periods of <@%s> since <t:%d:f>", BID, sinceTime.Unix()),
+		Color:       defaultColor,
+		Timestamp:   now.UTC().Format(time.RFC3339),
+	}}
+	makeOutageList(embed[0], spans, 1)
+	var files []*discordgo.File
+	size, count := chartBuckets(since)
+	chart, err := attachChart(embed[0], [][]float64{bucketAvailability(statusSpans(bot, events, now), now, size, count)})
+	if err != nil {
+		logMessage(s, "[HISTORY] error rendering chart |", err)
+	} else {
+		files = append(files, chart)
+	}
+	key := BID + "-" + strconv.FormatInt(sinceTime.Unix(), 10)
+	responseData := &discordgo.InteractionResponseData{
+		Embeds:     embed,
+		Files:      files,
+		Components: pageButtons("outages", key, 1, pageCount(len(spans), outagesPerPage)),
+	}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	err = s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		logMessage(s, "[HISTORY] error responding |", err)
+	}
+}
+
+// routes a bot or role to a channel, or removes the route
+func route(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	subcommand := i.ApplicationCommandData().Options[0]
+	action := SetRoute{GID: i.GuildID}
+	for _, option := range subcommand.Options {
+		switch option.Name {
+		case "channel":
+			action.CID = option.Value.(string)
+		case "bot":
+			action.BID = option.Value.(string)
+		case "role":
+			action.RID = option.Value.(string)
+		}
+	}
+
+	var embed []*discordgo.MessageEmbed
+	_, err := store.GetGuild(i.GuildID)
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Route request failed",
+			Description: "This server isn't being watched, use /watch set first",
+			Color:       failColor,
+		}}
+	} else if (action.BID == "") == (action.RID == "") {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Route request failed",
+			Description: "Pick either a bot or a role",
+			Color:       failColor,
+		}}
+	} else if err = addToQueue(action); err != nil {
+		logMessage(s, "[ROUTE] error queueing request |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Route request failed",
+			Description: "Couldn't save your request, try again later",
+			Color:       failColor,
+		}}
+	} else {
+		target := "<@" + action.BID + ">"
+		if action.RID != "" {
+			target = "Bots with <@&" + action.RID + ">"
+		}
+		description := target + " alerts go to the default channel"
+		if action.CID != "" {
+			description = target + " alerts go to <#" + action.CID + ">"
+		}
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Route request successful",
+			Description: description,
+			Color:       successColor,
+		}}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// lists where alerts go in the server
+func listRoutes(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var embed []*discordgo.MessageEmbed
+	guild, err := store.GetGuild(i.GuildID)
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "List routes failed",
+			Description: "This server isn't being watched, use /watch set first",
+			Color:       failColor,
+		}}
+	} else {
+		description := "Default channel <#" + guild.CID + ">"
+		var routed []string
+		for BID := range guild.Settings.BotChannels {
+			routed = append(routed, BID)
+		}
+		sort.Strings(routed)
+		for _, BID := range routed {
+			description += "\n<@" + BID + "> → <#" + guild.Settings.BotChannels[BID] + ">"
+		}
+		for _, route := range guild.Settings.RoleChannels {
+			description += "\n<@&" + route.RID + "> → <#" + route.CID + ">"
+		}
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Routes",
+			Description: description,
+			Color:       defaultColor,
+		}}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// adds or removes a role or user pinged about the server's bots, or about one bot
+func mention(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	subcommand := i.ApplicationCommandData().Options[0]
+	action := SetMention{GID: i.GuildID, Remove: subcommand.Name == "remove"}
+	for _, option := range subcommand.Options {
+		switch option.Name {
+		case "role":
+			action.RID = option.Value.(string)
+		case "user":
+			action.UID = option.Value.(string)
+		case "bot":
+			action.BID = option.Value.(string)
+		}
+	}
+
+	var embed []*discordgo.MessageEmbed
+	_, err := store.GetGuild(i.GuildID)
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Mention request failed",
+			Description: "This server isn't being watched, use /watch set first",
+			Color:       failColor,
+		}}
+	} else if action.RID == "" && action.UID == "" {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Mention request failed",
+			Description: "Pick a role or a user",
+			Color:       failColor,
+		}}
+	} else if err = addToQueue(action); err != nil {
+		logMessage(s, "[MENTION] error queueing request |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Mention request failed",
+			Description: "Couldn't save your request, try again later",
+			Color:       failColor,
+		}}
+	} else {
+		var targets []string
+		if action.RID != "" {
+			targets = append(targets, "<@&"+action.RID+">")
+		}
+		if action.UID != "" {
+			targets = append(targets, "<@"+action.UID+">")
+		}
+		about := "any bot"
+		if action.BID != "" {
+			about = "<@" + action.BID + ">"
+		}
+		description := strings.Join(targets, " and ") + " will be pinged when " + about + " goes offline"
+		if action.Remove {
+			description = strings.Join(targets, " and ") + " won't be pinged about " + about + " anymore"
+		}
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Mention request successful",
+			Description: description,
+			Color:       successColor,
+		}}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// chooses whether mentions also ping when a bot comes back online
+func mentionRecovery(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	action := SetMentionRecovery{GID: i.GuildID}
+	for _, option := range i.ApplicationCommandData().Options[0].Options {
+		switch option.Name {
+		case "enabled":
+			action.Recovery = option.Value.(bool)
+		case "bot":
+			action.BID = option.Value.(string)
+		}
+	}
+
+	var embed []*discordgo.MessageEmbed
+	_, err := store.GetGuild(i.GuildID)
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Mention request failed",
+			Description: "This server isn't being watched, use /watch set first",
+			Color:       failColor,
+		}}
+	} else if err = addToQueue(action); err != nil {
+		logMessage(s, "[MENTION RECOVERY] error queueing request |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Mention request failed",
+			Description: "Couldn't save your request, try again later",
+			Color:       failColor,
+		}}
+	} else {
+		about := "any bot"
+		if action.BID != "" {
+			about = "<@" + action.BID + ">"
+		}
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Mention request successful",
+			Description: "```PING ON RECOVERY\n" + onOff(action.Recovery) + "```For " + about,
+			Color:       successColor,
+		}}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// lists who gets pinged in the server
+func listMentions(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var embed []*discordgo.MessageEmbed
+	guild, err := store.GetGuild(i.GuildID)
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "List mentions failed",
+			Description: "This server isn't being watched, use /watch set first",
+			Color:       failColor,
+		}}
+	} else {
+		description := "Any bot → " + mentionList(guild.Settings.Mentions)
+		var bots []string
+		for BID := range guild.Settings.BotMentions {
+			bots = append(bots, BID)
+		}
+		sort.Strings(bots)
+		for _, BID := range bots {
+			description += "\n<@" + BID + "> → " + mentionList(guild.Settings.BotMentions[BID])
+		}
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Mentions",
+			Description: description,
+			Color:       defaultColor,
+		}}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// sets parts of the server's template for an alert, or resets it
+func setTemplate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	subcommand := i.ApplicationCommandData().Options[0]
+	action := SetTemplate{GID: i.GuildID}
+	var changes AlertTemplate
+	for _, option := range subcommand.Options {
+		switch option.Name {
+		case "alert":
+			action.Kind = option.Value.(string)
+		case "title":
+			changes.Title = option.Value.(string)
+		case "description":
+			changes.Description = option.Value.(string)
+		case "color":
+			changes.Color = option.Value.(string)
+		case "footer":
+			changes.Footer = option.Value.(string)
+		}
+	}
+
+	var embed []*discordgo.MessageEmbed
+	guild, err := store.GetGuild(i.GuildID)
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Template request failed",
+			Description: "This server isn't being watched, use /watch set first",
+			Color:       failColor,
+		}}
+		responseData := &discordgo.InteractionResponseData{Embeds: embed}
+		response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+		go s.InteractionRespond(i.Interaction, response)
+		return
+	}
+
+	// set only replaces the parts it's given
+	if subcommand.Name == "set" {
+		template := guild.Settings.Templates[action.Kind]
+		if changes.Title != "" {
+			template.Title = changes.Title
+		}
+		if changes.Description != "" {
+			template.Description = changes.Description
+		}
+		if changes.Color != "" {
+			template.Color = changes.Color
+		}
+		if changes.Footer != "" {
+			template.Footer = changes.Footer
+		}
+		action.Template = &template
+		err = validateTemplate(action.Kind, template)
+	}
+
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Template request failed",
+			Description: "```" + err.Error() + "```",
+			Color:       failColor,
+		}}
+	} else if err = addToQueue(action); err != nil {
+		logMessage(s, "[TEMPLATE] error queueing request |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Template request failed",
+			Description: "Couldn't save your request, try again later",
+			Color:       failColor,
+		}}
+	} else {
+		description := "The " + action.Kind + " alert is back to the default"
+		if action.Template != nil {
+			description = "The " + action.Kind + " alert was updated, use /template preview to see it"
+		}
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Template request successful",
+			Description: description,
+			Color:       successColor,
+		}}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// shows what an alert looks like in the server, about OfflineNotifier itself
+func previewTemplate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	kind := i.ApplicationCommandData().Options[0].Options[0].Value.(string)
+
+	var embed []*discordgo.MessageEmbed
+	guild, err := store.GetGuild(i.GuildID)
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Template preview failed",
+			Description: "This server isn't being watched, use /watch set first",
+			Color:       failColor,
+		}}
+	} else {
+		alert := sampleAlert(kind, s.State.User.ID, s.State.User.Username)
+		preview := alertEmbed(alert)
+		if template, exists := guild.Settings.Templates[kind]; exists {
+			err = applyTemplate(preview, template, alertData(alert, guildName(s, guild.ID), guild.ID))
+		}
+		if err != nil {
+			embed = []*discordgo.MessageEmbed{{
+				Title:       "Template preview failed",
+				Description: "```" + err.Error() + "```",
+				Color:       failColor,
+			}}
+		} else {
+			embed = []*discordgo.MessageEmbed{preview}
+		}
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
+
+// sets or removes the server's webhook, a new secret is shown only to whoever
+// set it
+func setWebhook(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	subcommand := i.ApplicationCommandData().Options[0]
+	action := SetWebhook{GID: i.GuildID}
+	if subcommand.Name == "set" {
+		action.URL = subcommand.Options[0].Value.(string)
+	}
+
+	var embed []*discordgo.MessageEmbed
+	_, err := store.GetGuild(i.GuildID)
+	if err != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Webhook request failed",
+			Description: "This server isn't being watched, use /watch set first",
+			Color:       failColor,
+		}}
+	} else if action.URL != "" && validateWebhookURL(action.URL) != nil {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Webhook request failed",
+			Description: "Use an https URL like https://example.com/alerts",
 			Color:       failColor,
 		}}
 	} else {
-		if discordBot.User.Bot && BID != s.State.User.ID {
-			addToQueue("as", [4]string{UID, BID})
+		if action.URL != "" {
+			action.Secret, err = newWebhookSecret()
+		}
+		if err == nil {
+			err = addToQueue(action)
+		}
+		if err != nil {
+			logMessage(s, "[WEBHOOK] error queueing request |", err)
 			embed = []*discordgo.MessageEmbed{{
-				Title:       "Subscribe request successful",
-				Description: "You are now subscribed to " + discordBot.User.Username,
+				Title:       "Webhook request failed",
+				Description: "Couldn't save your request, try again later",
+				Color:       failColor,
+			}}
+		} else if action.URL == "" {
+			embed = []*discordgo.MessageEmbed{{
+				Title:       "Webhook request successful",
+				Description: "Alerts aren't posted to a webhook anymore",
 				Color:       successColor,
 			}}
 		} else {
 			embed = []*discordgo.MessageEmbed{{
-				Title:       "Subscribe request failed",
-				Description: discordBot.User.Username + " is not a valid bot!",
-				Color:       failColor,
+				Title:       "Webhook request successful",
+				Description: "Alerts are posted to " + action.URL + "\nCheck the X-OfflineNotifier-Signature header with this secret, it won't be shown again```" + action.Secret + "```",
+				Color:       successColor,
 			}}
 		}
 	}
-	responseData := &discordgo.InteractionResponseData{Embeds: embed}
-	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
-	go s.InteractionRespond(i.Interaction, response)
-}
-
-// support - sends a server invite for nooby's bot sanctuary
-func support(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	embed := []*discordgo.MessageEmbed{{
-		Title: "Need help with OfflineNotifier? Join this server!",
-		URL:   "https://discord.gg/YDRKdkh",
-		Color: defaultColor,
-	}}
-	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed, Flags: discordgo.MessageFlagsEphemeral}
 	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
 	go s.InteractionRespond(i.Interaction, response)
 }
 
-// unsubscribes from a bot
-func unsubscribe(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	BID := i.ApplicationCommandData().Options[0].Options[0].Value.(string)
-	UID := i.Member.User.ID
+// posts a test event to the server's webhook, once without retries
+func testWebhook(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	guild, err := store.GetGuild(i.GuildID)
+	if err != nil || guild.Settings.Webhook.URL == "" {
+		embed := []*discordgo.MessageEmbed{{
+			Title:       "Webhook test failed",
+			Description: "This server doesn't have a webhook, use /webhook set first",
+			Color:       failColor,
+		}}
+		responseData := &discordgo.InteractionResponseData{Embeds: embed}
+		response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+		go s.InteractionRespond(i.Interaction, response)
+		return
+	}
 
-	addToQueue("rs", [4]string{UID, BID})
-	embed := []*discordgo.MessageEmbed{{
-		Title: "Unsubscribe request successful!",
-		Color: successColor,
-	}}
-	responseData := &discordgo.InteractionResponseData{Embeds: embed}
-	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	// placeholder, the receiver has up to 10 seconds to answer
+	embeds := []*discordgo.MessageEmbed{
+		{
+			Title: "Posting test event...",
+			Color: defaultColor,
+		},
+	}
+	data := &discordgo.InteractionResponseData{Embeds: embeds}
+	response := &discordgo.InteractionResponse{Type: 4, Data: data}
 	go s.InteractionRespond(i.Interaction, response)
-}
-
-// ----- JSON MAP FUNCTIONS
 
-// reads from a json file and returns a specific bot
-func getJsonBot(BID string) (bot Bot, err error) {
-	jsonData, err := os.ReadFile("data.json")
+	alert := sampleAlert("offline", s.State.User.ID, s.State.User.Username)
+	event := makeWebhookEvent(guild.ID, alert)
+	event.Event = "test"
+	body, err := json.Marshal(event)
+	if err == nil {
+		err = postWebhook(guild.Settings.Webhook, body)
+	}
+	if err != nil {
+		embeds = []*discordgo.MessageEmbed{{
+			Title:       "Webhook test failed",
+			Description: "```" + err.Error() + "```",
+			Color:       failColor,
+		}}
+	} else {
+		embeds = []*discordgo.MessageEmbed{{
+			Title:       "Webhook test successful",
+			Description: "The webhook accepted the test event",
+			Color:       successColor,
+		}}
+	}
+	edit := &discordgo.WebhookEdit{Embeds: &embeds}
+	_, err = s.InteractionResponseEdit(i.Interaction, edit)
 	if err != nil {
+		logMessage(s, "[WEBHOOK TEST] error editing response |", err)
+	}
+}
+
+// shows a bot's availability, outages and time to recovery from its history,
+// or that of every bot in the server when no bot is given
+func uptime(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		serverUptime(s, i)
 		return
 	}
+	BID := options[0].Value.(string)
 
-	var jsonMap map[string]map[string]map[string]interface{} // hehehehehehe....
-	err = json.Unmarshal(jsonData, &jsonMap)
+	var embed []*discordgo.MessageEmbed
+	bot, err := store.GetBot(BID)
+	if err != nil || !visibleBot(i, bot) {
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Uptime request failed",
+			Description: notVisible(i, BID),
+			Color:       failColor,
+		}}
+		responseData := &discordgo.InteractionResponseData{Embeds: embed}
+		response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+		go s.InteractionRespond(i.Interaction, response)
+		return
+	}
+	events, err := history.Events(BID, time.Unix(0, 0))
 	if err != nil {
+		logMessage(s, "[UPTIME] error getting history |", err)
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Uptime request failed",
+			Description: "Couldn't read the bot's history, try again later",
+			Color:       failColor,
+		}}
+		responseData := &discordgo.InteractionResponseData{Embeds: embed}
+		response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+		go s.InteractionRespond(i.Interaction, response)
 		return
 	}
 
-	botValue, exists := jsonMap["bots"][BID]
-	if exists {
-		bot = Bot{ID: BID}
-		if botValue["guilds"] != nil {
-			for _, guild := range botValue["guilds"].([]interface{}) {
-				bot.Guilds = append(bot.Guilds, guild.(string))
+	name := "<@" + BID + ">"
+	if discordBot, err := botUser(s, i.GuildID, BID); err == nil {
+		name = discordBot.Username
+	}
+	now := time.Now()
+	spans := statusSpans(bot, events, now)
+	var fields []*discordgo.MessageEmbedField
+	for _, w := range uptimeWindows {
+		report := makeUptimeReport(spans, now, w.window)
+		value := "```NO HISTORY YET```"
+		if report.covered > 0 {
+			value = "```" + strconv.FormatFloat(report.availability(), 'f', 2, 64) + "%" +
+				"\nOUTAGES\n" + strconv.Itoa(report.outages) +
+				"\nLONGEST\n" + formatDuration(report.longest) +
+				"\nMTTR\n" + formatDuration(report.mttr)
+			if report.covered < report.window-time.Minute {
+				value += "\n-----------\nHISTORY\n" + formatDuration(report.covered)
 			}
+			value += "```"
 		}
-		if botValue["subscribers"] != nil {
-			for _, subscriber := range botValue["subscribers"].([]interface{}) {
-				bot.Subscribers = append(bot.Subscribers, subscriber.(string))
-			}
-		}
-		if botValue["status"] != nil {
-			bot.Status = botValue["status"].(string)
-		}
-		if botValue["timestamp"] != nil {
-			bot.Timestamp = int64(botValue["timestamp"].(float64))
-		}
+		fields = append(fields, &discordgo.MessageEmbedField{Name: w.name, Value: value, Inline: true})
+	}
+	embed = []*discordgo.MessageEmbed{{
+		Title:       name + " uptime",
+		Description: "Daily status over the last 30 days",
+		Timestamp:   now.UTC().Format(time.RFC3339),
+		Color:       defaultColor,
+		Fields:      fields,
+	}}
+	var files []*discordgo.File
+	chart, err := attachChart(embed[0], [][]float64{bucketAvailability(spans, now, 24*time.Hour, 30)})
+	if err != nil {
+		logMessage(s, "[UPTIME] error rendering chart |", err)
 	} else {
-		err = errors.New("bot not found")
+		files = append(files, chart)
 	}
-	return
+	responseData := &discordgo.InteractionResponseData{Embeds: embed, Files: files}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
 }
 
-// reads from a json file and returns a bot map
-func getJsonBotMap() (botMap map[string]Bot, err error) {
-	jsonData, err := os.ReadFile("data.json")
+// bots shown by a server's /uptime, the most an embed has fields for
+const maxUptimeBots = 25
+
+// shows the last 30 days of every bot watched in the server
+func serverUptime(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var embed []*discordgo.MessageEmbed
+	guild, err := store.GetGuild(i.GuildID)
 	if err != nil {
+		description := "Bots aren't being watched in this server"
+		if i.GuildID == "" {
+			description = "Pick a bot to show"
+		}
+		embed = []*discordgo.MessageEmbed{{
+			Title:       "Uptime request failed",
+			Description: description,
+			Color:       failColor,
+		}}
+		responseData := &discordgo.InteractionResponseData{Embeds: embed}
+		response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+		go s.InteractionRespond(i.Interaction, response)
 		return
 	}
 
-	var jsonMap map[string]map[string]map[string]interface{} // MWAHAHAHAHAHA
-	err = json.Unmarshal(jsonData, &jsonMap)
+	// make placeholder embed
+	embed = []*discordgo.MessageEmbed{{
+		Title: "Loading uptime...",
+		Color: defaultColor,
+	}}
+	responseData := &discordgo.InteractionResponseData{Embeds: embed}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	err = s.InteractionRespond(i.Interaction, response)
 	if err != nil {
+		logMessage(s, "[UPTIME] error responding |", err)
 		return
 	}
 
-	botsInterface := jsonMap["bots"]
-	botMap = make(map[string]Bot)
-	for botKey, botValue := range botsInterface {
-		bot := Bot{ID: botKey}
-		if botValue["guilds"] != nil {
-			for _, guild := range botValue["guilds"].([]interface{}) {
-				bot.Guilds = append(bot.Guilds, guild.(string))
-			}
+	bots := guild.Bots
+	if len(bots) > maxUptimeBots {
+		bots = bots[:maxUptimeBots]
+	}
+	now := time.Now()
+	var fields []*discordgo.MessageEmbedField
+	var rows [][]float64
+	for _, BID := range bots {
+		bot, err := store.GetBot(BID)
+		if err != nil {
+			continue
 		}
-		if botValue["subscribers"] != nil {
-			for _, subscriber := range botValue["subscribers"].([]interface{}) {
-				bot.Subscribers = append(bot.Subscribers, subscriber.(string))
-			}
+		events, err := history.Events(BID, time.Unix(0, 0))
+		if err != nil {
+			logMessage(s, "[UPTIME] error getting history |", err)
+			continue
 		}
-		if botValue["status"] != nil {
-			bot.Status = botValue["status"].(string)
+		name := "<@" + BID + ">"
+		if discordBot, err := guildUser(s, i.GuildID, BID); err == nil {
+			name = discordBot.Username
 		}
-		if botValue["timestamp"] != nil {
-			bot.Timestamp = int64(botValue["timestamp"].(float64))
+		spans := statusSpans(bot, events, now)
+		report := makeUptimeReport(spans, now, 30*24*time.Hour)
+		value := "```NO HISTORY YET```"
+		if report.covered > 0 {
+			value = "```" + strconv.FormatFloat(report.availability(), 'f', 2, 64) + "%\nOUTAGES\n" + strconv.Itoa(report.outages) + "```"
 		}
-		botMap[botKey] = bot
+		fields = append(fields, &discordgo.MessageEmbedField{Name: name, Value: value, Inline: true})
+		rows = append(rows, bucketAvailability(spans, now, 24*time.Hour, 30))
 	}
-	return
-}
 
-// reads from a json file and returns a specific guild
-func getJsonGuild(GID string) (guild Guild, err error) {
-	jsonData, err := os.ReadFile("data.json") // TODO
-	if err != nil {
-		return
+	description := "Daily status over the last 30 days, one row per bot in the order below"
+	if len(guild.Bots) > maxUptimeBots {
+		description += fmt.Sprintf(" (first %d of %d bots)", maxUptimeBots, len(guild.Bots))
 	}
-
-	var jsonMap map[string]map[string]map[string]interface{} // it works just trust
-	err = json.Unmarshal(jsonData, &jsonMap)
+	embed = []*discordgo.MessageEmbed{{
+		Title:       "Uptime of bots in this server",
+		Description: description,
+		Timestamp:   now.UTC().Format(time.RFC3339),
+		Color:       defaultColor,
+		Fields:      fields,
+	}}
+	edit := &discordgo.WebhookEdit{Embeds: &embed}
+	if len(rows) > 0 {
+		chart, err := attachChart(embed[0], rows)
+		if err != nil {
+			logMessage(s, "[UPTIME] error rendering chart |", err)
+		} else {
+			edit.Files = []*discordgo.File{chart}
+		}
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, edit)
 	if err != nil {
-		return
+		logMessage(s, "[UPTIME] error editing response |", err)
 	}
+}
 
-	guildValue, exists := jsonMap["guilds"][GID]
-	if exists {
-		guild = Guild{ID: GID}
-		if guildValue["cid"] != nil {
-			guild.CID = guildValue["cid"].(string)
-		}
-		if guildValue["bots"] != nil {
-			for _, bot := range guildValue["bots"].([]interface{}) {
-				guild.Bots = append(guild.Bots, bot.(string))
-			}
+// ----- FRAMEWORK FUNCTIONS
+
+// looks through an ID array to find the matching ID, returns the index
+func indexID(array []string, ID string) (i int, err error) {
+	for i = range array {
+		if array[i] == ID {
+			return
 		}
-	} else {
-		err = errors.New("guild not found")
 	}
+	err = errors.New("not in list")
 	return
 }
 
-// reads from a json file and returns a guild map
-func getJsonGuildMap() (guildMap map[string]Guild, err error) {
-	jsonData, err := os.ReadFile("data.json")
+// removes an ID from an ID array without keeping order
+func removeID(array []string, ID string) ([]string, error) {
+	i, err := indexID(array, ID)
 	if err != nil {
-		return
+		return array, err
 	}
+	array[i] = array[len(array)-1]
+	return array[:len(array)-1], nil
+}
 
-	var jsonMap map[string]map[string]map[string]interface{}
-	err = json.Unmarshal(jsonData, &jsonMap)
-	if err != nil {
-		return
+// calculate time delta
+func calculateDeltaTime(unixTime int64) string {
+	return formatDuration(time.Since(time.Unix(unixTime, 0)))
+}
+
+// formats a duration as days, hours, minutes and seconds
+func formatDuration(d time.Duration) string {
+	seconds := int64(d / time.Second)
+	if seconds < 0 {
+		seconds = 0
+	}
+	day := strconv.FormatInt(seconds/86400, 10)
+	hour := strconv.FormatInt(seconds/3600%24, 10)
+	minute := strconv.FormatInt(seconds/60%60, 10)
+	second := strconv.FormatInt(seconds%60, 10)
+	return day + "D " + hour + "H " + minute + "M " + second + "S"
+}
+
+// last status seen for each bot. It's checked and replaced in one step so a
+// transition reported by several servers or events is only handled once.
+var (
+	seenStatus   = make(map[string]string)
+	seenStatusMu sync.Mutex
+)
+
+// records status as a bot's latest and returns the one it replaces. stored
+// is the status in the store, used until the bot has been seen.
+func swapStatus(BID string, status string, stored string) string {
+	seenStatusMu.Lock()
+	defer seenStatusMu.Unlock()
+	previous, exists := seenStatus[BID]
+	if !exists || stored == "unknown" {
+		previous = stored
+	}
+	seenStatus[BID] = status
+	return previous
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
 	}
+	return "off"
+}
+
+// last activity text seen for each bot
+var (
+	seenActivity   = make(map[string]string)
+	seenActivityMu sync.Mutex
+)
+
+// records activity as a bot's latest and returns the one it replaces
+func swapActivity(BID string, activity string) (previous string, seen bool) {
+	seenActivityMu.Lock()
+	defer seenActivityMu.Unlock()
+	previous, seen = seenActivity[BID]
+	seenActivity[BID] = activity
+	return
+}
 
-	guildInterface := jsonMap["guilds"]
-	guildMap = make(map[string]Guild)
-	for guildKey, guildValue := range guildInterface {
-		guild := Guild{ID: guildKey}
-		if guildValue["cid"] != nil {
-			guild.CID = guildValue["cid"].(string)
+// describes a presence's activities the way discord shows them
+func activityText(activities []*discordgo.Activity) string {
+	var texts []string
+	for _, activity := range activities {
+		if activity == nil {
+			continue
 		}
-		if guildValue["bots"] != nil {
-			for _, bot := range guildValue["bots"].([]interface{}) {
-				guild.Bots = append(guild.Bots, bot.(string))
+		switch activity.Type {
+		case discordgo.ActivityTypeGame:
+			texts = append(texts, "Playing "+activity.Name)
+		case discordgo.ActivityTypeStreaming:
+			texts = append(texts, "Streaming "+activity.Name)
+		case discordgo.ActivityTypeListening:
+			texts = append(texts, "Listening to "+activity.Name)
+		case discordgo.ActivityTypeWatching:
+			texts = append(texts, "Watching "+activity.Name)
+		case discordgo.ActivityTypeCompeting:
+			texts = append(texts, "Competing in "+activity.Name)
+		case discordgo.ActivityTypeCustom:
+			text := strings.TrimSpace(activity.Emoji.Name + " " + activity.State)
+			if text != "" {
+				texts = append(texts, text)
 			}
 		}
-		guildMap[guildKey] = guild
 	}
-	return
+	return strings.Join(texts, "\n")
 }
 
-// reads from a json file and returns a subscriber
-func getJsonSubscriber(SID string) (subscriber Subscriber, err error) {
-	jsonData, err := os.ReadFile("data.json")
-	if err != nil {
-		return
-	}
+// how often requestBots reconciles watched servers, RECONCILE_INTERVAL or 1m
+func reconcileInterval() time.Duration {
+	return envDuration("RECONCILE_INTERVAL", time.Minute)
+}
 
-	var jsonMap map[string]map[string]map[string]interface{} // hehehehehehe....
-	err = json.Unmarshal(jsonData, &jsonMap)
-	if err != nil {
-		return
+// reads a positive duration such as "30s" from the environment
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
 	}
+	return value
+}
 
-	subscriberValue, exists := jsonMap["subscribers"][SID]
-	if exists {
-		subscriber = Subscriber{ID: SID}
-		if subscriberValue["bots"] != nil {
-			for _, bot := range subscriberValue["bots"].([]interface{}) {
-				subscriber.Bots = append(subscriber.Bots, bot.(string))
-			}
-		} else {
-			err = errors.New("no bots found")
-		}
-	} else {
-		err = errors.New("subscriber not found")
+// reads a non negative integer from the environment
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value < 0 {
+		return fallback
 	}
-	return
+	return value
 }
 
-// reads from a json file and returns a subscriber map
-func getJsonSubscriberMap() (subscriberMap map[string]Subscriber, err error) {
-	jsonData, err := os.ReadFile("data.json")
+// gets a member's user from the state cache, falling back to the API
+func guildUser(s *discordgo.Session, GID string, UID string) (*discordgo.User, error) {
+	member, err := guildMember(s, GID, UID)
 	if err != nil {
-		return
+		return nil, err
 	}
+	return member.User, nil
+}
 
-	var jsonMap map[string]map[string]map[string]interface{}
-	err = json.Unmarshal(jsonData, &jsonMap)
-	if err != nil {
-		return
+// gets a member from the state cache, falling back to the API
+func guildMember(s *discordgo.Session, GID string, UID string) (*discordgo.Member, error) {
+	member, err := s.State.Member(GID, UID)
+	if err == nil && member.User != nil {
+		return member, nil
 	}
+	return s.GuildMember(GID, UID)
+}
 
-	subscribersInterface := jsonMap["subscribers"]
-	subscriberMap = make(map[string]Subscriber)
-	for subscriberKey, subscriberValue := range subscribersInterface {
-		subscriber := Subscriber{ID: subscriberKey}
-		if subscriberValue["bots"] != nil {
-			for _, bot := range subscriberValue["bots"].([]interface{}) {
-				subscriber.Bots = append(subscriber.Bots, bot.(string))
-			}
-		}
-		subscriberMap[subscriberKey] = subscriber
+// gets a bot's user, from the server if there is one
+func botUser(s *discordgo.Session, GID string, BID string) (*discordgo.User, error) {
+	if GID != "" {
+		return guildUser(s, GID, BID)
 	}
-	return
+	return s.User(BID)
 }
 
-// ----- FRAMEWORK FUNCTIONS
+// whether a bot can be looked up from where an interaction came from, it has
+// to be watched in the server, or subscribed to by the user in DMs
+func visibleBot(i *discordgo.InteractionCreate, bot Bot) bool {
+	if i.GuildID != "" {
+		_, err := indexID(bot.Guilds, i.GuildID)
+		return err == nil
+	}
+	if i.User == nil {
+		return false
+	}
+	_, err := indexID(bot.Subscribers, i.User.ID)
+	return err == nil
+}
 
-// adds actions into the action queue
-func addToQueue(action string, data [4]string) {
-	request := Request{action, data}
-	actionQueue = append(actionQueue, request)
+// why visibleBot turned a bot down
+func notVisible(i *discordgo.InteractionCreate, BID string) string {
+	if i.GuildID != "" {
+		return "<@" + BID + "> isn't being watched in this server"
+	}
+	return "<@" + BID + "> isn't one of your subscriptions"
 }
 
-// looks through an ID array to find the matching ID, returns the index
-func indexID(array []string, ID string) (i int, err error) {
-	for i = range array {
-		if array[i] == ID {
-			return
-		}
+// dead letters shown by /deadletter list
+const maxDeadLettersListed = 10
+
+// whether an interaction comes from the bot owner
+func fromOwner(i *discordgo.InteractionCreate) bool {
+	if i.Member != nil {
+		return i.Member.User.ID == ownerID
 	}
-	err = errors.New("not in list")
-	return
+	return i.User != nil && i.User.ID == ownerID
 }
 
-// calculate time delta
-func calculateDeltaTime(unixTime int64) string {
-	// calculate
-	currentTime := time.Now().Unix()
-	diffUnix := currentTime - unixTime
-	diffTime := time.Unix(diffUnix, 0).UTC()
-
-	// format
-	day := strconv.FormatInt(int64((diffTime.YearDay()-1)*(diffTime.Year()-1969)), 10)
-	hour := strconv.FormatInt(int64(diffTime.Hour()), 10)
-	minute := strconv.FormatInt(int64(diffTime.Minute()), 10)
-	second := strconv.FormatInt(int64(diffTime.Second()), 10)
-	return day + "D " + hour + "H " + minute + "M " + second + "S"
+// the response to anyone but the owner using an owner command
+func ownerOnlyEmbed(title string) []*discordgo.MessageEmbed {
+	return []*discordgo.MessageEmbed{{
+		Title:       title,
+		Description: "Only the owner of OfflineNotifier can do this",
+		Color:       failColor,
+	}}
 }
 
 // sends strings to the log and then DMs the bot owner
@@ -984,19 +3100,63 @@ func sendEmbed(s *discordgo.Session, CID string, embed *discordgo.MessageEmbed)
 	}
 }
 
+// outages shown on each page of an outage list
+const outagesPerPage = 8
+
+// fills in a page of an outage list
+func makeOutageList(embed *discordgo.MessageEmbed, spans []statusSpan, page int) {
+	embed.Footer = &discordgo.MessageEmbedFooter{
+		Text: fmt.Sprintf("%d/%d", page, pageCount(len(spans), outagesPerPage)),
+	}
+	if len(spans) == 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "No outages",
+			Value: "```Nothing recorded in this period```",
+		})
+		return
+	}
+
+	pageStart := (page - 1) * outagesPerPage
+	pageEnd := pageStart + outagesPerPage
+	if pageEnd > len(spans) {
+		pageEnd = len(spans)
+	}
+	for n, span := range spans[pageStart:pageEnd] {
+		end := span.end.UTC().Format(outageTimeFormat)
+		if span.ongoing {
+			end = "still offline"
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Outage " + strconv.Itoa(len(spans)-pageStart-n),
+			Value:  "```START\n" + span.start.UTC().Format(outageTimeFormat) + "\n-----------\nEND\n" + end + "\n-----------\nDURATION\n" + formatDuration(span.end.Sub(span.start)) + "```",
+			Inline: true,
+		})
+	}
+}
+
+const outageTimeFormat = "2006-01-02 15:04 MST"
+
+// number of pages needed for a list, at least one
+func pageCount(items int, perPage int) int {
+	if items <= perPage {
+		return 1
+	}
+	return (items + perPage - 1) / perPage
+}
+
 // makes list for bot embed
 func makeBotList(s *discordgo.Session, embed *discordgo.MessageEmbed, bots []string, page int) error {
-	pageStart := ((page - 1) * 8)
-	pageEnd := page*8 + 1 // len(bots) = 1 (0 - 1); pageEnd =
+	pageStart := (page - 1) * botsPerPage
+	pageEnd := pageStart + botsPerPage
 	if pageEnd > len(bots) {
 		pageEnd = len(bots)
 	}
 	embed.Footer = &discordgo.MessageEmbedFooter{
-		Text: fmt.Sprintf("%d/%d", page, int(math.Ceil(float64(len(bots))/9))),
+		Text: fmt.Sprintf("%d/%d", page, pageCount(len(bots), botsPerPage)),
 	}
 
 	for _, BID := range bots[pageStart:pageEnd] {
-		bot, err := getJsonBot(BID)
+		bot, err := store.GetBot(BID)
 		if err != nil {
 			logMessage(s, "[MAKE BOT LIST] error getting json bot |", err)
 			return err
@@ -1032,348 +3192,18 @@ func makeBotList(s *discordgo.Session, embed *discordgo.MessageEmbed, bots []str
 
 // ----- TICKER FUNCTIONS
 
-// reads from action queue and does subsequent actions
-func queueHandler(s *discordgo.Session) {
-	if len(actionQueue) > 0 {
-		// get guild map
-		guildMap, err := getJsonGuildMap()
-		if err != nil {
-			logMessage(s, "[QUEUE HANDLER] error getting guild map |", err)
-			return
-		}
-
-		// get bot map
-		botMap, err := getJsonBotMap()
-		if err != nil {
-			logMessage(s, "[QUEUE HANDLER] error getting bot map |", err)
-			return
-		}
-
-		// get subscriber map
-		subscriberMap, err := getJsonSubscriberMap()
-		if err != nil {
-			logMessage(s, "[QUEUE HANDLER] error getting subscriber map |", err)
-			return
-		}
-
-		// go through action queue
-		for len(actionQueue) > 0 {
-			request := actionQueue[0]
-			switch request.action {
-			// ASSIGN CHANNEL - [GID, CID]
-			case "ac":
-				GID := request.data[0]
-				CID := request.data[1]
-
-				guild, exists := guildMap[GID]
-				if exists {
-					guild.CID = CID
-					guildMap[GID] = guild
-				} else {
-					guild = Guild{
-						ID:   GID,
-						CID:  CID,
-						Bots: []string{},
-					}
-					guildMap[GID] = guild
-				}
-			// REMOVE GUILD - [GID]
-			case "rg":
-				GID := request.data[0]
-
-				_, exists := guildMap[GID]
-				if exists {
-					// loop through guild's bot list
-					for _, BID := range guildMap[GID].Bots {
-						bot, exists := botMap[BID]
-						if exists {
-							i, err := indexID(bot.Guilds, GID)
-							if err != nil {
-								logMessage(s, "[REMOVE GUILD] error indexing GID |", err)
-								continue
-							}
-							// remove GID from bot's guild list
-							if len(bot.Guilds) == 1 {
-								// loop through bot's subscriber list
-								for _, SID := range bot.Subscribers {
-									subscriber, exists := subscriberMap[SID]
-									if exists {
-										i, err := indexID(subscriber.Bots, BID)
-										if err != nil {
-											logMessage(s, "[REMOVE GUILD] error indexing BID |", err)
-											continue
-										}
-										// remove BID from subscriber's bot list
-										if len(subscriber.Bots) == 1 {
-											delete(subscriberMap, SID)
-										} else {
-											subscriber.Bots[i] = subscriber.Bots[len(subscriber.Bots)-1]
-											subscriber.Bots = subscriber.Bots[:len(subscriber.Bots)-1]
-											subscriberMap[SID] = subscriber
-										}
-									} else {
-										logMessage(s, "[REMOVE GUILD] error finding subscriber | not in subscriber map")
-										continue
-									}
-								}
-								delete(botMap, BID)
-							} else {
-								bot.Guilds[i] = bot.Guilds[len(bot.Guilds)-1]
-								bot.Guilds = bot.Guilds[:len(bot.Guilds)-1]
-								botMap[BID] = bot
-							}
-						} else {
-							logMessage(s, "[REMOVE GUILD] error finding bot | not in bot map")
-							actionQueue = actionQueue[1:]
-							continue
-						}
-					}
-					// delete guild
-					delete(guildMap, GID)
-				} else {
-					logMessage(s, "[REMOVE GUILD] error finding guild | not in guild map")
-					actionQueue = actionQueue[1:]
-					continue
-				}
-			// SET STATUS - [BID, Status, changeTimestamp]
-			case "ss":
-				BID := request.data[0]
-				Status := request.data[1]
-
-				bot, exists := botMap[BID]
-				if exists {
-					bot.Status = Status
-					if request.data[2] == "true" {
-						bot.Timestamp = time.Now().Unix()
-					}
-					botMap[BID] = bot
-				} else {
-					logMessage(s, "[SET STATUS] error finding bot | not in bot map")
-					actionQueue = actionQueue[1:]
-					continue
-				}
-			// ADD BOT - [GID, BID]
-			case "ab":
-				GID := request.data[0]
-				BID := request.data[1]
-
-				// add BID to guild's bot list
-				guild, exists := guildMap[GID]
-				if exists {
-					// check for duplicate
-					_, err = indexID(guild.Bots, BID)
-					if err != nil {
-						guild.Bots = append(guild.Bots, BID)
-						guildMap[GID] = guild
-					}
-				} else {
-					logMessage(s, "[ADD BOT] error finding guild | not in guild map")
-					actionQueue = actionQueue[1:]
-					continue
-				}
-
-				// add GID to bot's guild list
-				bot, exists := botMap[BID]
-				if exists {
-					// check for duplicate
-					_, err = indexID(bot.Guilds, GID)
-					if err != nil {
-						bot.Guilds = append(bot.Guilds, GID)
-						botMap[BID] = bot
-					}
-				} else {
-					botMap[BID] = Bot{
-						ID:          BID,
-						Guilds:      []string{GID},
-						Subscribers: []string{},
-						Status:      "unknown",
-						Timestamp:   time.Now().Unix(),
-					}
-				}
-			// REMOVE BOT - [GID, BID]
-			case "rb":
-				GID := request.data[0]
-				BID := request.data[1]
-
-				guild, exists := guildMap[GID]
-				if exists {
-					i, err := indexID(guild.Bots, BID)
-					if err != nil {
-						logMessage(s, "[REMOVE BOT] error indexing BID |", err)
-						actionQueue = actionQueue[1:]
-						continue
-					}
-					// remove BID from guild's bot list
-					if len(guild.Bots) == 1 {
-						guild.Bots = []string{}
-						guildMap[GID] = guild
-					} else {
-						guild.Bots[i] = guild.Bots[len(guild.Bots)-1]
-						guild.Bots = guild.Bots[:len(guild.Bots)-1]
-						guildMap[GID] = guild
-					}
-				} else {
-					logMessage(s, "[REMOVE BOT] error finding guild | not in guild map")
-					actionQueue = actionQueue[1:]
-					continue
-				}
-
-				bot, exists := botMap[BID]
-				if exists {
-					i, err := indexID(bot.Guilds, GID)
-					if err != nil {
-						logMessage(s, "[REMOVE BOT] error indexing GID |", err)
-						actionQueue = actionQueue[1:]
-						continue
-					}
-					// remove GID from bot's guild list
-					if len(bot.Guilds) == 1 {
-						// loop through bot's subscriber list
-						for _, SID := range bot.Subscribers {
-							subscriber, exists := subscriberMap[SID]
-							if exists {
-								i, err := indexID(subscriber.Bots, BID)
-								if err != nil {
-									logMessage(s, "[REMOVE BOT] error indexing BID |", err)
-									continue
-								}
-								// remove BID from subscriber's bot list
-								if len(subscriber.Bots) == 1 {
-									delete(subscriberMap, SID)
-								} else {
-									subscriber.Bots[i] = subscriber.Bots[len(subscriber.Bots)-1]
-									subscriber.Bots = subscriber.Bots[:len(subscriber.Bots)-1]
-									subscriberMap[SID] = subscriber
-								}
-							} else {
-								logMessage(s, "[REMOVE BOT] error finding subscriber | not in subscriber map")
-								continue
-							}
-						}
-						delete(botMap, BID)
-					} else {
-						bot.Guilds[i] = bot.Guilds[len(bot.Guilds)-1]
-						bot.Guilds = bot.Guilds[:len(bot.Guilds)-1]
-						botMap[BID] = bot
-					}
-				} else {
-					logMessage(s, "[ADD BOT] error finding bot | not in bot map")
-					actionQueue = actionQueue[1:]
-					continue
-				}
-			// ADD SUBSCRIBER [SID, BID]
-			case "as":
-				SID := request.data[0]
-				BID := request.data[1]
-
-				bot, exists := botMap[BID]
-				if exists {
-					// add SID to bot's subscriber list
-					// check for duplicate
-					_, err = indexID(bot.Subscribers, SID)
-					if err != nil {
-						bot.Subscribers = append(bot.Subscribers, SID)
-						botMap[BID] = bot
-					}
-				} else {
-					logMessage(s, "[ADD SUBSCRIBER] error finding bot | not in bot map")
-					actionQueue = actionQueue[1:]
-					continue
-				}
-
-				// add BID to subscriber's bot list
-				subscriber, exists := subscriberMap[SID]
-				if exists {
-					// check for duplicate
-					_, err = indexID(subscriber.Bots, BID)
-					if err != nil {
-						subscriber.Bots = append(subscriber.Bots, BID)
-						subscriberMap[SID] = subscriber
-					}
-				} else {
-					subscriberMap[SID] = Subscriber{
-						ID:   SID,
-						Bots: []string{BID},
-					}
-				}
-			// REMOVE SUBSCRIBER [SID, BID]
-			case "rs":
-				SID := request.data[0]
-				BID := request.data[1]
-
-				bot, exists := botMap[BID]
-				if exists {
-					i, err := indexID(bot.Subscribers, SID)
-					if err != nil {
-						logMessage(s, "[REMOVE SUBSCRIBER] error indexing SID |", err)
-						actionQueue = actionQueue[1:]
-						continue
-					}
-					// remove SID from bot's subscriber list
-					if len(bot.Subscribers) == 1 {
-						bot.Subscribers = []string{}
-						botMap[BID] = bot
-					} else {
-						bot.Subscribers[i] = bot.Subscribers[len(bot.Subscribers)-1]
-						bot.Subscribers = bot.Subscribers[:len(bot.Subscribers)-1]
-						botMap[BID] = bot
-					}
-				} else {
-					logMessage(s, "[REMOVE SUBSCRIBER] error finding bot | not in bot map")
-					actionQueue = actionQueue[1:]
-					continue
-				}
-
-				subscriber, exists := subscriberMap[SID]
-				if exists {
-					i, err := indexID(subscriber.Bots, BID)
-					if err != nil {
-						logMessage(s, "[REMOVE SUBSCRIBER] error indexing BID |", err)
-						actionQueue = actionQueue[1:]
-						continue
-					}
-					// remove BID from subscriber's bot list
-					if len(subscriber.Bots) == 1 {
-						delete(subscriberMap, SID)
-					} else {
-						subscriber.Bots[i] = subscriber.Bots[len(subscriber.Bots)-1]
-						subscriber.Bots = subscriber.Bots[:len(subscriber.Bots)-1]
-						subscriberMap[SID] = subscriber
-					}
-				} else {
-					logMessage(s, "[REMOVE SUBSCRIBER] error finding subscriber | not in subscriber map")
-					actionQueue = actionQueue[1:]
-					continue
-				}
-			}
-			// POP ACTION FROM QUEUE
-			actionQueue = actionQueue[1:]
-		}
-		jsonData, err := json.Marshal(map[string]interface{}{"guilds": guildMap, "bots": botMap, "subscribers": subscriberMap})
-		if err != nil {
-			logMessage(s, "[QUEUE HANDLER] error marshaling json |", err)
-			return
-		}
-		err = os.WriteFile("data.json", jsonData, 0755)
-		if err != nil {
-			logMessage(s, "[QUEUE HANDLER] error writing json |", err)
-			return
-		}
-	}
-}
-
 // goes through active guild list and checks for new bots,
 // requests presence list of bots, and culls removed bots.
 func requestBots(s *discordgo.Session) {
 	// get guild map
-	guildMap, err := getJsonGuildMap()
+	guildMap, err := store.ListGuilds()
 	if err != nil {
 		logMessage(s, "[REQUEST BOTS] error getting guild map |", err)
 		return
 	}
 
 	// update presence
-	botMap, err := getJsonBotMap()
+	botMap, err := store.ListBots()
 	if err != nil {
 		logMessage(s, "[REQUEST BOTS] error getting bot map |", err)
 		return
@@ -1388,7 +3218,7 @@ func requestBots(s *discordgo.Session) {
 			errstr := fmt.Sprint("[REQUEST BOTS] error getting discord guild | ", err)
 			if fmt.Sprintln(err) == "HTTP 404 Not Found, {\"message\": \"Unknown Guild\", \"code\": 10004}\n" {
 				errstr += " | removing guild..."
-				addToQueue("rg", [4]string{GID})
+				queueOrLog(s, RemoveGuild{GID: GID})
 			}
 			logMessage(s, errstr)
 			continue
@@ -1401,7 +3231,7 @@ func requestBots(s *discordgo.Session) {
 			if fmt.Sprintln(err) == "HTTP 403 Forbidden, {\"message\": \"Missing Access\", \"code\": 50001}\n" ||
 				fmt.Sprintln(err) == "HTTP 404 Not Found, {\"message\": \"Unknown Channel\", \"code\": 10003}\n" {
 				errstr += " | removing guild..."
-				addToQueue("rg", [4]string{guild.ID})
+				queueOrLog(s, RemoveGuild{GID: guild.ID})
 			}
 			logMessage(s, errstr)
 			continue
@@ -1415,13 +3245,15 @@ func requestBots(s *discordgo.Session) {
 		}
 
 		var bots = guild.Bots
+		changed := false
 		// add bots to request list
 		for _, member := range memberList {
-			if member.User.Bot && member.User.ID != s.State.User.ID {
+			if member.User.Bot && member.User.ID != s.State.User.ID && guild.Settings.watches(member.User.ID) {
 				i, err := indexID(bots, member.User.ID)
 				if err != nil {
 					// bot is not in data yet, add them
-					addToQueue("ab", [4]string{guild.ID, member.User.ID})
+					queueOrLog(s, AddBot{GID: guild.ID, BID: member.User.ID})
+					changed = true
 					continue
 				}
 				// pop element from list
@@ -1434,7 +3266,11 @@ func requestBots(s *discordgo.Session) {
 
 		// cull remaining bots
 		for _, cullBot := range bots {
-			addToQueue("rb", [4]string{guild.ID, cullBot})
+			queueOrLog(s, RemoveBot{GID: guild.ID, BID: cullBot})
+			changed = true
+		}
+		if changed {
+			scheduleBoard(s, guild.ID)
 		}
 
 		// request bot list
@@ -0,0 +1,659 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ----- ACTIONS
+
+// Action is a state change. Actions are sent through actionQueue and applied
+// one at a time by queueHandler, the only goroutine that writes to the store.
+type Action interface {
+	apply(s *discordgo.Session) error
+}
+
+// AssignChannel sets the channel for a guild and starts watching it
+type AssignChannel struct {
+	GID string
+	CID string
+}
+
+// RemoveGuild stops watching a guild
+type RemoveGuild struct {
+	GID string
+}
+
+// SetStatus records a bot's status, ChangeTimestamp restarts its up/downtime
+// from Time, the unix time of the change
+type SetStatus struct {
+	BID             string
+	Status          string
+	ChangeTimestamp bool
+	Time            int64
+}
+
+// AddBot starts watching a bot in a guild
+type AddBot struct {
+	GID string
+	BID string
+}
+
+// RemoveBot stops watching a bot in a guild
+type RemoveBot struct {
+	GID string
+	BID string
+}
+
+// AddSubscriber subscribes a user to a bot
+type AddSubscriber struct {
+	SID string
+	BID string
+}
+
+// RemoveSubscriber unsubscribes a user from a bot
+type RemoveSubscriber struct {
+	SID string
+	BID string
+}
+
+// SetGracePeriod sets how long a guild waits before alerting, for one bot if
+// BID is set. Clear drops a bot's own grace period.
+type SetGracePeriod struct {
+	GID     string
+	BID     string
+	Seconds int64
+	Clear   bool
+}
+
+// SetNotify turns opt-in alerts on or off for a guild, or for a subscriber if
+// SID is set. Settings left nil are kept.
+type SetNotify struct {
+	GID      string
+	SID      string
+	Status   *bool
+	Activity *bool
+}
+
+// SetDigest sets how often a guild gets availability digests from Time, the
+// unix time it was asked for. An empty Cadence turns them off.
+type SetDigest struct {
+	GID     string
+	Cadence string
+	Time    int64
+}
+
+// DigestSent records when a guild last got a digest
+type DigestSent struct {
+	GID  string
+	Time int64
+}
+
+// SetRoute sends a guild's alerts about a bot, or about bots with a role, to
+// a channel. An empty CID removes the route.
+type SetRoute struct {
+	GID string
+	BID string
+	RID string
+	CID string
+}
+
+// SetWatchList adds a bot to a guild's include list, or to its exclude list
+// if Exclude is set, taking it off the other one
+type SetWatchList struct {
+	GID     string
+	BID     string
+	Exclude bool
+}
+
+// SetExplicitOnly switches a guild between watching every bot that isn't
+// excluded and watching only included bots
+type SetExplicitOnly struct {
+	GID          string
+	ExplicitOnly bool
+}
+
+// SetMention adds a role or user to ping about a guild's bots, or about one
+// bot if BID is set, or takes it off if Remove is set
+type SetMention struct {
+	GID    string
+	BID    string
+	RID    string
+	UID    string
+	Remove bool
+}
+
+// SetMentionRecovery chooses whether a guild's mentions, or those of one bot,
+// also ping when a bot comes back online
+type SetMentionRecovery struct {
+	GID      string
+	BID      string
+	Recovery bool
+}
+
+// SetTemplate sets a guild's template for an alert kind, or removes it when
+// Template is nil
+type SetTemplate struct {
+	GID      string
+	Kind     string
+	Template *AlertTemplate
+}
+
+// SetWebhook sets where a guild's alerts are posted, an empty URL stops them
+type SetWebhook struct {
+	GID    string
+	URL    string
+	Secret string
+}
+
+// SetEmail starts verifying a subscriber's address, an empty Address stops
+// emails
+type SetEmail struct {
+	SID      string
+	Address  string
+	CodeHash string
+	CodeSent int64
+}
+
+// VerifyEmail starts emailing a subscriber, unless the address changed since
+// the code was checked
+type VerifyEmail struct {
+	SID     string
+	Address string
+}
+
+// SetBoard records a guild's status board, an empty MID forgets it
+type SetBoard struct {
+	GID string
+	CID string
+	MID string
+}
+
+// the time an action happened, actions journaled before they carried one
+// get the time they're applied
+func actionTime(unix int64) int64 {
+	if unix == 0 {
+		return time.Now().Unix()
+	}
+	return unix
+}
+
+// journals an action and adds it to the action queue. Once this returns
+// without an error the action survives a restart.
+func addToQueue(action Action) error {
+	return actionJournal.append(action, actionQueue)
+}
+
+// queues an action for a background task, which has nobody to report to
+func queueOrLog(s *discordgo.Session, action Action) {
+	err := addToQueue(action)
+	if err != nil {
+		logMessage(s, "[QUEUE] error queueing action |", err)
+	}
+}
+
+// applies actions from the action queue as they arrive
+func queueHandler(s *discordgo.Session) {
+	for entry := range actionQueue {
+		applyEntry(s, entry)
+	}
+}
+
+// applies a journaled action, the journal drops it once the result is flushed
+func applyEntry(s *discordgo.Session, entry journalEntry) {
+	err := state.Update(entry.Seq, func() error {
+		return entry.action.apply(s)
+	})
+	if err != nil {
+		logMessage(s, fmt.Sprintf("[QUEUE HANDLER] error applying %s %+v |", entry.Type, entry.action), err)
+	}
+}
+
+// applies actions left in the journal by the last run
+func replayJournal(s *discordgo.Session) {
+	entries := actionJournal.pending()
+	if len(entries) == 0 {
+		return
+	}
+	log.Println("[JOURNAL] replaying", len(entries), "actions...")
+	for _, entry := range entries {
+		applyEntry(s, entry)
+	}
+	err := state.Flush()
+	if err != nil {
+		log.Println("[JOURNAL] error flushing replayed actions |", err)
+	}
+}
+
+func (a AssignChannel) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err == errGuildNotFound {
+		guild = Guild{ID: a.GID, Bots: []string{}}
+	} else if err != nil {
+		return err
+	}
+	guild.CID = a.CID
+	return store.PutGuild(guild)
+}
+
+// removes a guild along with the bots that are only watched there
+func (a RemoveGuild) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	for _, BID := range guild.Bots {
+		err = detachBot(s, a.GID, BID)
+		if err != nil {
+			logMessage(s, "[REMOVE GUILD] error detaching bot |", err)
+		}
+	}
+	return store.DeleteGuild(a.GID)
+}
+
+func (a SetStatus) apply(s *discordgo.Session) error {
+	bot, err := store.GetBot(a.BID)
+	if err != nil {
+		return err
+	}
+	bot.Status = a.Status
+	if a.ChangeTimestamp {
+		bot.Timestamp = actionTime(a.Time)
+	}
+	return store.PutBot(bot)
+}
+
+func (a AddBot) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	bot, err := store.GetBot(a.BID)
+	if err == errBotNotFound {
+		bot = Bot{
+			ID:          a.BID,
+			Guilds:      []string{},
+			Subscribers: []string{},
+			Status:      "unknown",
+			Timestamp:   time.Now().Unix(),
+		}
+	} else if err != nil {
+		return err
+	}
+
+	// add GID to bot's guild list, the bot has to exist before the guild can list it
+	if _, err = indexID(bot.Guilds, a.GID); err != nil {
+		bot.Guilds = append(bot.Guilds, a.GID)
+		err = store.PutBot(bot)
+		if err != nil {
+			return err
+		}
+	}
+
+	// add BID to guild's bot list
+	if _, err = indexID(guild.Bots, a.BID); err == nil {
+		return nil
+	}
+	guild.Bots = append(guild.Bots, a.BID)
+	return store.PutGuild(guild)
+}
+
+func (a RemoveBot) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	guild.Bots, err = removeID(guild.Bots, a.BID)
+	if err != nil {
+		return err
+	}
+	delete(guild.Settings.BotChannels, a.BID)
+	delete(guild.Settings.BotGracePeriods, a.BID)
+	delete(guild.Settings.BotMentions, a.BID)
+	err = detachBot(s, a.GID, a.BID)
+	if err != nil {
+		logMessage(s, "[REMOVE BOT] error detaching bot |", err)
+	}
+	return store.PutGuild(guild)
+}
+
+// removes GID from a bot's guild list, deleting the bot and its
+// subscriptions once no guild is watching it anymore
+func detachBot(s *discordgo.Session, GID string, BID string) error {
+	bot, err := store.GetBot(BID)
+	if err != nil {
+		return err
+	}
+	bot.Guilds, err = removeID(bot.Guilds, GID)
+	if err != nil {
+		return err
+	}
+	if len(bot.Guilds) > 0 {
+		return store.PutBot(bot)
+	}
+
+	// loop through bot's subscriber list
+	for _, SID := range bot.Subscribers {
+		subscriber, err := store.GetSubscriber(SID)
+		if err != nil {
+			logMessage(s, "[DETACH BOT] error getting subscriber |", err)
+			continue
+		}
+		subscriber.Bots, err = removeID(subscriber.Bots, BID)
+		if err != nil {
+			logMessage(s, "[DETACH BOT] error indexing BID |", err)
+			continue
+		}
+		if len(subscriber.Bots) == 0 {
+			err = store.DeleteSubscriber(SID)
+		} else {
+			err = store.PutSubscriber(subscriber)
+		}
+		if err != nil {
+			logMessage(s, "[DETACH BOT] error updating subscriber |", err)
+		}
+	}
+	return store.DeleteBot(BID)
+}
+
+func (a AddSubscriber) apply(s *discordgo.Session) error {
+	bot, err := store.GetBot(a.BID)
+	if err != nil {
+		return err
+	}
+	subscriber, err := store.GetSubscriber(a.SID)
+	if err == errSubscriberNotFound {
+		subscriber = Subscriber{ID: a.SID, Bots: []string{}}
+	} else if err != nil {
+		return err
+	}
+
+	// add BID to subscriber's bot list, the subscriber has to exist before the bot can list it
+	if _, err = indexID(subscriber.Bots, a.BID); err != nil {
+		subscriber.Bots = append(subscriber.Bots, a.BID)
+		err = store.PutSubscriber(subscriber)
+		if err != nil {
+			return err
+		}
+	}
+
+	// add SID to bot's subscriber list
+	if _, err = indexID(bot.Subscribers, a.SID); err == nil {
+		return nil
+	}
+	bot.Subscribers = append(bot.Subscribers, a.SID)
+	return store.PutBot(bot)
+}
+
+func (a RemoveSubscriber) apply(s *discordgo.Session) error {
+	bot, err := store.GetBot(a.BID)
+	if err != nil {
+		return err
+	}
+	subscriber, err := store.GetSubscriber(a.SID)
+	if err != nil {
+		return err
+	}
+
+	// remove SID from bot's subscriber list
+	bot.Subscribers, err = removeID(bot.Subscribers, a.SID)
+	if err != nil {
+		return err
+	}
+	err = store.PutBot(bot)
+	if err != nil {
+		return err
+	}
+
+	// remove BID from subscriber's bot list
+	subscriber.Bots, err = removeID(subscriber.Bots, a.BID)
+	if err != nil {
+		return err
+	}
+	if len(subscriber.Bots) == 0 {
+		return store.DeleteSubscriber(a.SID)
+	}
+	return store.PutSubscriber(subscriber)
+}
+
+func (a SetGracePeriod) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case a.BID == "":
+		guild.Settings.GracePeriod = a.Seconds
+	case a.Clear:
+		delete(guild.Settings.BotGracePeriods, a.BID)
+	default:
+		if guild.Settings.BotGracePeriods == nil {
+			guild.Settings.BotGracePeriods = make(map[string]int64)
+		}
+		guild.Settings.BotGracePeriods[a.BID] = a.Seconds
+	}
+	return store.PutGuild(guild)
+}
+
+func (a SetNotify) apply(s *discordgo.Session) error {
+	if a.SID != "" {
+		subscriber, err := store.GetSubscriber(a.SID)
+		if err != nil {
+			return err
+		}
+		subscriber.Settings.Notify = a.merge(subscriber.Settings.Notify)
+		return store.PutSubscriber(subscriber)
+	}
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	guild.Settings.Notify = a.merge(guild.Settings.Notify)
+	return store.PutGuild(guild)
+}
+
+// the settings once this action is applied to notify
+func (a SetNotify) merge(notify NotifySettings) NotifySettings {
+	if a.Status != nil {
+		notify.Status = *a.Status
+	}
+	if a.Activity != nil {
+		notify.Activity = *a.Activity
+	}
+	return notify
+}
+
+// the first digest is the one due after the cadence was set
+func (a SetDigest) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	guild.Settings.Digest = DigestSettings{Cadence: a.Cadence}
+	if a.Cadence != "" {
+		guild.Settings.Digest.LastSent = actionTime(a.Time)
+	}
+	return store.PutGuild(guild)
+}
+
+func (a DigestSent) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	guild.Settings.Digest.LastSent = a.Time
+	return store.PutGuild(guild)
+}
+
+func (a SetRoute) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case a.BID != "" && a.CID == "":
+		delete(guild.Settings.BotChannels, a.BID)
+	case a.BID != "":
+		if guild.Settings.BotChannels == nil {
+			guild.Settings.BotChannels = make(map[string]string)
+		}
+		guild.Settings.BotChannels[a.BID] = a.CID
+	case a.RID != "":
+		guild.Settings.RoleChannels = setRoleChannel(guild.Settings.RoleChannels, a.RID, a.CID)
+	}
+	return store.PutGuild(guild)
+}
+
+// starts or stops watching the bot right away rather than on the next sweep
+func (a SetWatchList) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	settings := &guild.Settings
+	settings.Include, _ = removeID(settings.Include, a.BID)
+	settings.Exclude, _ = removeID(settings.Exclude, a.BID)
+	if a.Exclude {
+		settings.Exclude = append(settings.Exclude, a.BID)
+	} else {
+		settings.Include = append(settings.Include, a.BID)
+	}
+	err = store.PutGuild(guild)
+	if err != nil {
+		return err
+	}
+
+	_, err = indexID(guild.Bots, a.BID)
+	watched := err == nil
+	if watched && !settings.watches(a.BID) {
+		return RemoveBot{GID: a.GID, BID: a.BID}.apply(s)
+	}
+	if !watched && settings.watches(a.BID) {
+		return AddBot{GID: a.GID, BID: a.BID}.apply(s)
+	}
+	return nil
+}
+
+// stops watching bots that aren't included anymore, bots that are watched
+// again get picked up by the next sweep
+func (a SetExplicitOnly) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	guild.Settings.ExplicitOnly = a.ExplicitOnly
+	err = store.PutGuild(guild)
+	if err != nil {
+		return err
+	}
+	for _, BID := range guild.Bots {
+		if guild.Settings.watches(BID) {
+			continue
+		}
+		err = RemoveBot{GID: a.GID, BID: BID}.apply(s)
+		if err != nil {
+			logMessage(s, "[SET EXPLICIT ONLY] error removing bot |", err)
+		}
+	}
+	return nil
+}
+
+func (a SetMention) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	if a.BID == "" {
+		guild.Settings.Mentions = guild.Settings.Mentions.set(a.RID, a.UID, a.Remove)
+	} else {
+		guild.Settings.BotMentions = setBotMentions(guild.Settings.BotMentions, a.BID,
+			guild.Settings.BotMentions[a.BID].set(a.RID, a.UID, a.Remove))
+	}
+	return store.PutGuild(guild)
+}
+
+func (a SetMentionRecovery) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	if a.BID == "" {
+		guild.Settings.Mentions.Recovery = a.Recovery
+	} else {
+		mentions := guild.Settings.BotMentions[a.BID]
+		mentions.Recovery = a.Recovery
+		guild.Settings.BotMentions = setBotMentions(guild.Settings.BotMentions, a.BID, mentions)
+	}
+	return store.PutGuild(guild)
+}
+
+func (a SetTemplate) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	if a.Template == nil {
+		delete(guild.Settings.Templates, a.Kind)
+	} else {
+		if guild.Settings.Templates == nil {
+			guild.Settings.Templates = make(map[string]AlertTemplate)
+		}
+		guild.Settings.Templates[a.Kind] = *a.Template
+	}
+	return store.PutGuild(guild)
+}
+
+func (a SetWebhook) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	guild.Settings.Webhook = WebhookSettings{URL: a.URL, Secret: a.Secret}
+	return store.PutGuild(guild)
+}
+
+func (a SetEmail) apply(s *discordgo.Session) error {
+	subscriber, err := store.GetSubscriber(a.SID)
+	if err != nil {
+		return err
+	}
+	subscriber.Settings.Email = EmailSettings{Address: a.Address, CodeHash: a.CodeHash, CodeSent: a.CodeSent}
+	return store.PutSubscriber(subscriber)
+}
+
+func (a VerifyEmail) apply(s *discordgo.Session) error {
+	subscriber, err := store.GetSubscriber(a.SID)
+	if err != nil {
+		return err
+	}
+	if subscriber.Settings.Email.Address != a.Address {
+		return nil
+	}
+	subscriber.Settings.Email.Verified = true
+	subscriber.Settings.Email.CodeHash = ""
+	return store.PutSubscriber(subscriber)
+}
+
+func (a SetBoard) apply(s *discordgo.Session) error {
+	guild, err := store.GetGuild(a.GID)
+	if err != nil {
+		return err
+	}
+	guild.Settings.Board = BoardSettings{CID: a.CID, MID: a.MID}
+	return store.PutGuild(guild)
+}
+
+// whether a guild with these settings watches a bot
+func (settings GuildSettings) watches(BID string) bool {
+	if _, err := indexID(settings.Exclude, BID); err == nil {
+		return false
+	}
+	if settings.ExplicitOnly {
+		_, err := indexID(settings.Include, BID)
+		return err == nil
+	}
+	return true
+}
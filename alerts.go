@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ----- ALERTS
+
+// Alert is a status change worth telling a server or subscriber about
+type Alert struct {
+	// "offline", "online", "flapping", "stable", the opt-in "status" and
+	// "activity", or "batch" for several alerts sent together
+	Kind             string
+	BID              string
+	Name             string
+	Status           string
+	Previous         string
+	Activity         string
+	PreviousActivity string
+	Time             time.Time
+	// how long the previous status lasted, or the current one for "stable"
+	Duration time.Duration
+	// offline/online changes seen inside the flap window
+	Changes int
+	// the alerts gathered into a "batch"
+	Alerts []Alert
+}
+
+// destination is somewhere alerts go, a server's channel or a subscriber's DMs
+type destination struct {
+	GID string
+	SID string
+}
+
+// alerter decides when a bot's offline/online changes are reported. Changes
+// are held back for each destination's grace period, so a bot that comes
+// back quickly never triggers an alert, and a bot changing too often is
+// reported once as flapping until it settles down.
+type alerter struct {
+	mu   sync.Mutex
+	bots map[string]*botAlerts
+}
+
+// alert state of a single bot
+type botAlerts struct {
+	name     string
+	status   string
+	since    time.Time
+	changes  []time.Time
+	flapping bool
+	settle   *time.Timer
+	dests    map[destination]*destAlerts
+}
+
+// alert state of a single bot at a single destination
+type destAlerts struct {
+	// bumped on every change so a timer that already fired can tell it's stale
+	generation int
+	timer      *time.Timer
+	// last status the destination was told about and when it started
+	offline bool
+	since   time.Time
+}
+
+var alerts = &alerter{bots: make(map[string]*botAlerts)}
+
+// how long subscribers wait before being alerted, GRACE_PERIOD or 0s
+func subscriberGracePeriod() time.Duration {
+	return envDuration("GRACE_PERIOD", 0)
+}
+
+// how many offline/online changes inside the flap window make a bot
+// flapping, FLAP_THRESHOLD or 4 (0 turns flap detection off)
+func flapThreshold() int {
+	return envInt("FLAP_THRESHOLD", 4)
+}
+
+// how far back changes are counted, and how long a flapping bot has to stay
+// put before it's considered stable again, FLAP_WINDOW or 10m
+func flapWindow() time.Duration {
+	return envDuration("FLAP_WINDOW", 10*time.Minute)
+}
+
+// grace period of a bot at a destination
+func gracePeriod(dest destination, BID string) time.Duration {
+	if dest.SID != "" {
+		return subscriberGracePeriod()
+	}
+	guild, err := store.GetGuild(dest.GID)
+	if err != nil {
+		return 0
+	}
+	seconds, exists := guild.Settings.BotGracePeriods[BID]
+	if !exists {
+		seconds = guild.Settings.GracePeriod
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// every destination a bot's alerts go to
+func botDestinations(bot Bot) (dests []destination) {
+	for _, GID := range bot.Guilds {
+		dests = append(dests, destination{GID: GID})
+	}
+	for _, SID := range bot.Subscribers {
+		dests = append(dests, destination{SID: SID})
+	}
+	return
+}
+
+func (a *alerter) bot(BID string) *botAlerts {
+	ba, exists := a.bots[BID]
+	if !exists {
+		ba = &botAlerts{dests: make(map[destination]*destAlerts)}
+		a.bots[BID] = ba
+	}
+	return ba
+}
+
+// gets a destination's alert state, starting it from status and since when
+// the destination hasn't been seen yet
+func (ba *botAlerts) dest(dest destination, status string, since time.Time) *destAlerts {
+	da, exists := ba.dests[dest]
+	if !exists {
+		da = &destAlerts{offline: status == "offline", since: since}
+		ba.dests[dest] = da
+	}
+	return da
+}
+
+// stops any pending alert for a destination
+func (da *destAlerts) cancel() {
+	da.generation++
+	if da.timer != nil {
+		da.timer.Stop()
+		da.timer = nil
+	}
+}
+
+// handles a bot going offline or coming back online. bot is the bot as stored
+// before the change.
+func (a *alerter) change(s *discordgo.Session, bot Bot, name string, previous string, current string) {
+	now := time.Now()
+	lastChange := time.Unix(bot.Timestamp, 0)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ba := a.bot(bot.ID)
+	ba.name = name
+	ba.status = current
+	ba.since = now
+
+	// count recent changes
+	window := flapWindow()
+	recent := ba.changes[:0]
+	for _, change := range ba.changes {
+		if now.Sub(change) < window {
+			recent = append(recent, change)
+		}
+	}
+	ba.changes = append(recent, now)
+
+	if ba.flapping {
+		ba.settle.Reset(window)
+		return
+	}
+	dests := botDestinations(bot)
+	if threshold := flapThreshold(); threshold > 0 && len(ba.changes) >= threshold {
+		ba.flapping = true
+		alert := Alert{Kind: "flapping", BID: bot.ID, Name: name, Status: current, Previous: previous, Time: now, Changes: len(ba.changes)}
+		for _, dest := range dests {
+			ba.dest(dest, previous, lastChange).cancel()
+			go sendAlert(s, dest, alert)
+		}
+		BID := bot.ID
+		ba.settle = time.AfterFunc(window, func() { a.stable(s, BID) })
+		return
+	}
+
+	alert := Alert{Kind: "offline", BID: bot.ID, Name: name, Status: current, Previous: previous, Time: now}
+	if current != "offline" {
+		alert.Kind = "online"
+	}
+	for _, dest := range dests {
+		da := ba.dest(dest, previous, lastChange)
+		da.cancel()
+		if (current == "offline") == da.offline {
+			// the destination already thinks this, e.g. a blip inside the
+			// grace period or going offline again before recovery was sent
+			continue
+		}
+		destAlert := alert
+		destAlert.Duration = now.Sub(da.since)
+		fire := func() {
+			da.timer = nil
+			da.offline = current == "offline"
+			da.since = now
+			go sendAlert(s, dest, destAlert)
+		}
+		grace := gracePeriod(dest, bot.ID)
+		if grace <= 0 {
+			fire()
+			continue
+		}
+		generation := da.generation
+		da.timer = time.AfterFunc(grace, func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			if da.generation == generation {
+				fire()
+			}
+		})
+	}
+}
+
+// ends flapping once a bot has kept the same status for a whole flap window
+func (a *alerter) stable(s *discordgo.Session, BID string) {
+	bot, err := store.GetBot(BID)
+	if err != nil {
+		// not watched anymore
+		a.mu.Lock()
+		delete(a.bots, BID)
+		a.mu.Unlock()
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ba := a.bot(BID)
+	// the timer may have fired just as another change reset it
+	if !ba.flapping || time.Since(ba.since) < flapWindow() {
+		return
+	}
+	ba.flapping = false
+	ba.changes = nil
+	alert := Alert{Kind: "stable", BID: BID, Name: ba.name, Status: ba.status, Time: time.Now(), Duration: time.Since(ba.since)}
+	for _, dest := range botDestinations(bot) {
+		da := ba.dest(dest, ba.status, ba.since)
+		da.offline = ba.status == "offline"
+		da.since = ba.since
+		go sendAlert(s, dest, alert)
+	}
+}
+
+// sends an opt-in alert to every destination that asked for its kind
+func sendNotice(s *discordgo.Session, bot Bot, alert Alert) {
+	for _, dest := range botDestinations(bot) {
+		var notify NotifySettings
+		if dest.GID != "" {
+			guild, err := store.GetGuild(dest.GID)
+			if err != nil {
+				continue
+			}
+			notify = guild.Settings.Notify
+		} else {
+			subscriber, err := store.GetSubscriber(dest.SID)
+			if err != nil {
+				continue
+			}
+			notify = subscriber.Settings.Notify
+		}
+		if (alert.Kind == "status" && notify.Status) || (alert.Kind == "activity" && notify.Activity) {
+			go sendAlert(s, dest, alert)
+		}
+	}
+}
+
+// makes the embed for an alert
+func alertEmbed(alert Alert) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{Timestamp: alert.Time.UTC().Format(time.RFC3339)}
+	switch alert.Kind {
+	case "offline":
+		embed.Title = alert.Name + " is now offline"
+		embed.Description = "```TOTAL UPTIME\n" + formatDuration(alert.Duration) + "```"
+		embed.Color = offlineColor
+	case "online":
+		embed.Title = alert.Name + " is back online"
+		embed.Description = "```TOTAL DOWNTIME\n" + formatDuration(alert.Duration) + "```"
+		embed.Color = onlineColor
+	case "flapping":
+		embed.Title = alert.Name + " is flapping"
+		embed.Description = fmt.Sprintf("```STATUS CHANGES\n%d in the last %s\n-----------\nLAST STATUS\n%s```", alert.Changes, formatDuration(flapWindow()), alert.Status)
+		embed.Color = flappingColor
+	case "stable":
+		embed.Title = alert.Name + " has stopped flapping"
+		embed.Description = "```CURRENT STATUS\n" + alert.Status + "\n-----------\nSTABLE FOR\n" + formatDuration(alert.Duration) + "```"
+		embed.Color = onlineColor
+		if alert.Status == "offline" {
+			embed.Color = offlineColor
+		}
+	case "status":
+		embed.Title = alert.Name + " is now " + alert.Status
+		embed.Description = "```PREVIOUS STATUS\n" + alert.Previous + "```"
+		embed.Color = statusColor(alert.Status)
+	case "batch":
+		return batchEmbed(alert)
+	case "activity":
+		embed.Title = alert.Name + " changed its activity"
+		embed.Description = "```ACTIVITY\n" + orNone(alert.Activity) + "\n-----------\nPREVIOUS ACTIVITY\n" + orNone(alert.PreviousActivity) + "```"
+		embed.Color = defaultColor
+	}
+	return embed
+}
+
+// color of a discord status
+func statusColor(status string) int {
+	switch status {
+	case "idle":
+		return idleColor
+	case "dnd":
+		return dndColor
+	case "offline", "invisible":
+		return offlineColor
+	}
+	return onlineColor
+}
+
+func orNone(text string) string {
+	if text == "" {
+		return "none"
+	}
+	return text
+}
+
+// sends an alert to a destination, unless it stopped watching the bot while
+// the alert was held back
+func sendAlert(s *discordgo.Session, dest destination, alert Alert) {
+	for _, notifier := range destNotifiers(s, dest, alert.BID) {
+		queueDelivery(s, dest, notifier, alert)
+	}
+}
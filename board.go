@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/pkg/errors"
+)
+
+// ----- STATUS BOARDS
+
+// how long board edits are held back, so a burst of changes makes one edit
+const boardDelay = 2 * time.Second
+
+// guilds with a board edit on the way
+var (
+	boardUpdates   = make(map[string]bool)
+	boardUpdatesMu sync.Mutex
+)
+
+// indicator shown next to each status
+var boardIndicators = map[string]string{
+	"online":  "🟢",
+	"idle":    "🟡",
+	"dnd":     "🔴",
+	"offline": "⚫",
+}
+
+// edits the board of every guild watching a bot
+func updateBoards(s *discordgo.Session, bot Bot) {
+	for _, GID := range bot.Guilds {
+		scheduleBoard(s, GID)
+	}
+}
+
+// edits a guild's board once boardDelay has passed
+func scheduleBoard(s *discordgo.Session, GID string) {
+	boardUpdatesMu.Lock()
+	defer boardUpdatesMu.Unlock()
+	if boardUpdates[GID] {
+		return
+	}
+	boardUpdates[GID] = true
+	time.AfterFunc(boardDelay, func() {
+		boardUpdatesMu.Lock()
+		delete(boardUpdates, GID)
+		boardUpdatesMu.Unlock()
+		refreshBoard(s, GID)
+	})
+}
+
+// edits a guild's board, posting it again if it was deleted and dropping it
+// if its channel is gone
+func refreshBoard(s *discordgo.Session, GID string) {
+	guild, err := store.GetGuild(GID)
+	if err != nil || guild.Settings.Board.MID == "" {
+		return
+	}
+	board := guild.Settings.Board
+	_, err = s.ChannelMessageEditEmbed(board.CID, board.MID, makeBoard(s, guild))
+	switch discordErrorCode(err) {
+	case 0:
+		if err != nil {
+			logMessage(s, "[BOARD] error editing board |", err)
+		}
+	case discordgo.ErrCodeUnknownMessage:
+		_, err = postBoard(s, guild, board.CID)
+		if err != nil {
+			logMessage(s, "[BOARD] error posting board again |", err)
+		}
+	case discordgo.ErrCodeUnknownChannel, discordgo.ErrCodeMissingAccess:
+		queueOrLog(s, SetBoard{GID: GID})
+	default:
+		logMessage(s, "[BOARD] error editing board |", err)
+	}
+}
+
+// the code of a discord API error, 0 for other errors
+func discordErrorCode(err error) int {
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Message != nil {
+		return restErr.Message.Code
+	}
+	return 0
+}
+
+// posts and pins a new board in a channel and records it for the guild
+func postBoard(s *discordgo.Session, guild Guild, CID string) (*discordgo.Message, error) {
+	message, err := s.ChannelMessageSendEmbed(CID, makeBoard(s, guild))
+	if err != nil {
+		return nil, err
+	}
+	// the board works unpinned too, pinning needs manage messages
+	err = s.ChannelMessagePin(CID, message.ID)
+	if err != nil {
+		logMessage(s, "[BOARD] error pinning board |", err)
+	}
+	return message, addToQueue(SetBoard{GID: guild.ID, CID: CID, MID: message.ID})
+}
+
+// a line of the board
+type boardLine struct {
+	name string
+	bot  Bot
+}
+
+// makes the board embed, bots that are down first
+func makeBoard(s *discordgo.Session, guild Guild) *discordgo.MessageEmbed {
+	var lines []boardLine
+	for _, BID := range guild.Bots {
+		bot, err := store.GetBot(BID)
+		if err != nil {
+			continue
+		}
+		name := "<@" + BID + ">"
+		if discordBot, err := guildUser(s, guild.ID, BID); err == nil {
+			name = discordBot.Username
+		}
+		lines = append(lines, boardLine{name: name, bot: bot})
+	}
+	down := func(bot Bot) bool { return bot.Status == "offline" || bot.Status == "unknown" }
+	sort.SliceStable(lines, func(i, j int) bool {
+		if down(lines[i].bot) != down(lines[j].bot) {
+			return down(lines[i].bot)
+		}
+		return strings.ToLower(lines[i].name) < strings.ToLower(lines[j].name)
+	})
+
+	embed := &discordgo.MessageEmbed{
+		Title:     "Status board",
+		Color:     onlineColor,
+		Footer:    &discordgo.MessageEmbedFooter{Text: "Last updated"},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	if len(lines) == 0 {
+		embed.Description = "No bots are being watched in this server"
+		embed.Color = defaultColor
+		return embed
+	}
+	for n, line := range lines {
+		indicator, exists := boardIndicators[line.bot.Status]
+		if !exists {
+			indicator = "⚪"
+		}
+		since := "up"
+		if down(line.bot) {
+			since = "down"
+			embed.Color = offlineColor
+		}
+		text := fmt.Sprintf("%s **%s** %s, %s since <t:%d:R>\n", indicator, line.name, line.bot.Status, since, line.bot.Timestamp)
+		if len(embed.Description)+len(text) > maxDescriptionLength-32 {
+			embed.Description += fmt.Sprintf("and %d more", len(lines)-n)
+			break
+		}
+		embed.Description += text
+	}
+	return embed
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ----- CHARTS
+
+// sizes of a status chart in pixels
+const (
+	chartBarWidth  = 8
+	chartBarGap    = 2
+	chartRowHeight = 28
+	chartRowGap    = 8
+	chartPadding   = 10
+)
+
+var (
+	chartBackground = rgb(0x36393f)
+	chartNoData     = rgb(0x202225)
+	chartUp         = rgb(onlineColor)
+	chartPartial    = rgb(idleColor)
+	chartDown       = rgb(offlineColor)
+)
+
+func rgb(hex int) color.RGBA {
+	return color.RGBA{R: uint8(hex >> 16), G: uint8(hex >> 8), B: uint8(hex), A: 0xff}
+}
+
+// share of each bucket the bot spent online, from 0 to 1, or -1 for buckets
+// history doesn't cover. Buckets are size long and the last one ends at now.
+func bucketAvailability(spans []statusSpan, now time.Time, size time.Duration, count int) []float64 {
+	buckets := make([]float64, count)
+	start := now.Add(-size * time.Duration(count))
+	for n := range buckets {
+		bucketStart := start.Add(size * time.Duration(n))
+		bucketEnd := bucketStart.Add(size)
+		var up, down time.Duration
+		for _, span := range spans {
+			spanStart, spanEnd := span.start, span.end
+			if spanStart.Before(bucketStart) {
+				spanStart = bucketStart
+			}
+			if spanEnd.After(bucketEnd) {
+				spanEnd = bucketEnd
+			}
+			if !spanEnd.After(spanStart) {
+				continue
+			}
+			switch span.status {
+			case "unknown":
+			case "offline":
+				down += spanEnd.Sub(spanStart)
+			default:
+				up += spanEnd.Sub(spanStart)
+			}
+		}
+		buckets[n] = -1
+		if up+down > 0 {
+			buckets[n] = float64(up) / float64(up+down)
+		}
+	}
+	return buckets
+}
+
+// draws a status page style chart, one row of bars per bot with the oldest
+// bucket on the left
+func renderChart(rows [][]float64) ([]byte, error) {
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	width := 2*chartPadding + columns*(chartBarWidth+chartBarGap) - chartBarGap
+	height := 2*chartPadding + len(rows)*(chartRowHeight+chartRowGap) - chartRowGap
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{chartBackground}, image.Point{}, draw.Src)
+
+	for y, row := range rows {
+		top := chartPadding + y*(chartRowHeight+chartRowGap)
+		for x, availability := range row {
+			left := chartPadding + x*(chartBarWidth+chartBarGap)
+			fill := chartNoData
+			switch {
+			case availability < 0:
+			case availability >= 0.999:
+				fill = chartUp
+			case availability <= 0.001:
+				fill = chartDown
+			default:
+				fill = chartPartial
+			}
+			bar := image.Rect(left, top, left+chartBarWidth, top+chartRowHeight)
+			draw.Draw(img, bar, &image.Uniform{fill}, image.Point{}, draw.Src)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+// picks buckets for a chart covering window, hourly up to two days and daily
+// after that, at most 90 of them
+func chartBuckets(window time.Duration) (size time.Duration, count int) {
+	size = time.Hour
+	if window > 48*time.Hour {
+		size = 24 * time.Hour
+	}
+	count = int((window + size - 1) / size)
+	if count > 90 {
+		count = 90
+	}
+	if count < 1 {
+		count = 1
+	}
+	return
+}
+
+// renders a chart and attaches it to embed, returning the file to send along
+func attachChart(embed *discordgo.MessageEmbed, rows [][]float64) (*discordgo.File, error) {
+	data, err := renderChart(rows)
+	if err != nil {
+		return nil, err
+	}
+	embed.Image = &discordgo.MessageEmbedImage{URL: "attachment://chart.png"}
+	return &discordgo.File{Name: "chart.png", ContentType: "image/png", Reader: bytes.NewReader(data)}, nil
+}
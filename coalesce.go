@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ----- COALESCING
+
+// how long alerts for a channel are gathered before they're sent together,
+// COALESCE_WINDOW or 3s
+func coalesceWindow() time.Duration {
+	return envDuration("COALESCE_WINDOW", 3*time.Second)
+}
+
+// most messages sent to a channel in a minute, CHANNEL_RATE_LIMIT or 10 (0 for
+// no limit). Alerts past the limit wait and are sent together.
+func channelRateLimit() int {
+	return envInt("CHANNEL_RATE_LIMIT", 10)
+}
+
+// alerts waiting to go to one channel
+type alertBatch struct {
+	dest     destination
+	notifier Notifier
+	alerts   []Alert
+	pending  bool
+	// when messages went to the channel in the last minute
+	sent []time.Time
+}
+
+var (
+	batches   = make(map[string]*alertBatch)
+	batchesMu sync.Mutex
+)
+
+// hands an alert for a discord channel to its batch, other notifiers get it
+// right away. Batches are per destination, so alerts for different routes or
+// destinations never end up in the same message.
+func queueDelivery(s *discordgo.Session, dest destination, notifier Notifier, alert Alert) {
+	if notifier.Kind() != "discord" {
+		dispatch(s, dest, notifier, alert)
+		return
+	}
+	key := deliveryKey(dest, notifier)
+	batchesMu.Lock()
+	defer batchesMu.Unlock()
+	batch, exists := batches[key]
+	if !exists {
+		batch = &alertBatch{dest: dest}
+		batches[key] = batch
+	}
+	// the newest notifier has the newest settings
+	batch.notifier = notifier
+	batch.alerts = append(batch.alerts, alert)
+	if batch.pending {
+		return
+	}
+	batch.pending = true
+	wait := coalesceWindow()
+	now := time.Now()
+	batch.sent = recentSends(batch.sent, now)
+	if limit := channelRateLimit(); limit > 0 && len(batch.sent) >= limit {
+		if free := batch.sent[len(batch.sent)-limit].Add(time.Minute).Sub(now); free > wait {
+			wait = free
+		}
+	}
+	time.AfterFunc(wait, func() { flushBatch(s, key) })
+}
+
+// hands everything a batch gathered to the delivery line, as one message if
+// there's more than one
+func flushBatch(s *discordgo.Session, key string) {
+	batchesMu.Lock()
+	batch := batches[key]
+	alerts := batch.alerts
+	dest, notifier := batch.dest, batch.notifier
+	batch.alerts = nil
+	batch.pending = false
+	now := time.Now()
+	batch.sent = append(recentSends(batch.sent, now), now)
+	// forget channels that have been quiet for a minute
+	for other, b := range batches {
+		if !b.pending && len(recentSends(b.sent, now)) == 0 {
+			delete(batches, other)
+		}
+	}
+	batchesMu.Unlock()
+
+	if len(alerts) == 1 {
+		dispatch(s, dest, notifier, alerts[0])
+		return
+	}
+	dispatch(s, dest, notifier, batchAlert(alerts))
+}
+
+// drops sends older than a minute
+func recentSends(sent []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(sent) && now.Sub(sent[i]) >= time.Minute {
+		i++
+	}
+	return sent[i:]
+}
+
+// wraps several alerts into one, alerts that are batches already are unwrapped
+func batchAlert(batched []Alert) Alert {
+	var alerts []Alert
+	for _, alert := range batched {
+		if alert.Kind == "batch" {
+			alerts = append(alerts, alert.Alerts...)
+		} else {
+			alerts = append(alerts, alert)
+		}
+	}
+	return Alert{
+		Kind:   "batch",
+		BID:    alerts[0].BID,
+		Name:   fmt.Sprintf("%d bots", len(alerts)),
+		Time:   alerts[len(alerts)-1].Time,
+		Alerts: alerts,
+	}
+}
+
+// how a batch title puts each kind of alert
+var batchPhrases = map[string]string{
+	"offline":  "went offline",
+	"online":   "came back online",
+	"flapping": "started flapping",
+	"stable":   "stopped flapping",
+	"status":   "changed status",
+	"activity": "changed activity",
+}
+
+// makes the embed for a batch, one line per alert
+func batchEmbed(alert Alert) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:     fmt.Sprintf("%d bot alerts", len(alert.Alerts)),
+		Color:     flappingColor,
+		Timestamp: alert.Time.UTC().Format(time.RFC3339),
+	}
+	kind := alert.Alerts[0].Kind
+	for _, a := range alert.Alerts {
+		if a.Kind != kind {
+			kind = ""
+			break
+		}
+	}
+	if kind != "" {
+		embed.Title = fmt.Sprintf("%d bots %s", len(alert.Alerts), batchPhrases[kind])
+		embed.Color = alertEmbed(alert.Alerts[0]).Color
+	}
+	for n, a := range alert.Alerts {
+		line := "- " + alertEmbed(a).Title + "\n"
+		if len(embed.Description)+len(line) > maxDescriptionLength-32 {
+			embed.Description += fmt.Sprintf("and %d more", len(alert.Alerts)-n)
+			break
+		}
+		embed.Description += line
+	}
+	return embed
+}
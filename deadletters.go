@@ -0,0 +1,250 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ----- DEAD LETTERS
+
+// DeadLetter is an alert that couldn't be delivered
+type DeadLetter struct {
+	ID int64 `json:"id"`
+	// unix time of the last attempt
+	Time int64  `json:"time"`
+	GID  string `json:"guild,omitempty"`
+	SID  string `json:"subscriber,omitempty"`
+	// the kind of notifier that failed, "discord", "webhook" or "email"
+	Channel  string `json:"channel"`
+	Alert    Alert  `json:"alert"`
+	Error    string `json:"error"`
+	Attempts int    `json:"attempts"`
+}
+
+var errDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetters keeps failed deliveries until the owner replays or drops them
+type DeadLetters interface {
+	// stores a letter under a new ID, dropping the oldest past the limit
+	Add(letter DeadLetter) (int64, error)
+	// every letter, oldest first
+	List() ([]DeadLetter, error)
+	Get(ID int64) (DeadLetter, error)
+	Remove(ID int64) error
+	Close() error
+}
+
+// opens the dead letters next to the store, like the history
+func openDeadLetters(st Store) (DeadLetters, error) {
+	if ss, ok := st.(*sqliteStore); ok {
+		return &sqliteDeadLetters{db: ss.db}, nil
+	}
+	return openJsonDeadLetters(deadLetterPath())
+}
+
+// path of the json dead letters, DEAD_LETTER_PATH or deadletters.json
+func deadLetterPath() string {
+	path := os.Getenv("DEAD_LETTER_PATH")
+	if path == "" {
+		path = "deadletters.json"
+	}
+	return path
+}
+
+// how many dead letters are kept, DEAD_LETTER_MAX or 500
+func deadLetterMax() int {
+	return envInt("DEAD_LETTER_MAX", 500)
+}
+
+// the dead letters, opened in main
+var deadLetters DeadLetters
+
+// ----- JSON DEAD LETTERS
+
+// jsonDeadLetters keeps the letters in memory and rewrites the file on changes
+type jsonDeadLetters struct {
+	path    string
+	mu      sync.Mutex
+	letters []DeadLetter
+	next    int64
+}
+
+func openJsonDeadLetters(path string) (*jsonDeadLetters, error) {
+	jd := &jsonDeadLetters{path: path, next: 1}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return jd, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &jd.letters)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing dead letters")
+	}
+	for _, letter := range jd.letters {
+		if letter.ID >= jd.next {
+			jd.next = letter.ID + 1
+		}
+	}
+	return jd, nil
+}
+
+func (jd *jsonDeadLetters) Add(letter DeadLetter) (int64, error) {
+	jd.mu.Lock()
+	defer jd.mu.Unlock()
+	letter.ID = jd.next
+	jd.next++
+	jd.letters = append(jd.letters, letter)
+	if limit := deadLetterMax(); limit > 0 && len(jd.letters) > limit {
+		jd.letters = jd.letters[len(jd.letters)-limit:]
+	}
+	return letter.ID, jd.write()
+}
+
+func (jd *jsonDeadLetters) List() ([]DeadLetter, error) {
+	jd.mu.Lock()
+	defer jd.mu.Unlock()
+	return append([]DeadLetter{}, jd.letters...), nil
+}
+
+func (jd *jsonDeadLetters) Get(ID int64) (DeadLetter, error) {
+	jd.mu.Lock()
+	defer jd.mu.Unlock()
+	for _, letter := range jd.letters {
+		if letter.ID == ID {
+			return letter, nil
+		}
+	}
+	return DeadLetter{}, errDeadLetterNotFound
+}
+
+func (jd *jsonDeadLetters) Remove(ID int64) error {
+	jd.mu.Lock()
+	defer jd.mu.Unlock()
+	for n, letter := range jd.letters {
+		if letter.ID == ID {
+			jd.letters = append(jd.letters[:n], jd.letters[n+1:]...)
+			return jd.write()
+		}
+	}
+	return errDeadLetterNotFound
+}
+
+// atomically replaces the file with the letters in memory
+func (jd *jsonDeadLetters) write() error {
+	data, err := json.Marshal(nonNilLetters(jd.letters))
+	if err != nil {
+		return err
+	}
+	tmp, err := writeTempFile(jd.path, data)
+	if err != nil {
+		return errors.Wrap(err, "writing dead letters")
+	}
+	defer os.Remove(tmp)
+	err = os.Rename(tmp, jd.path)
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(jd.path))
+}
+
+func (jd *jsonDeadLetters) Close() error {
+	return nil
+}
+
+func nonNilLetters(letters []DeadLetter) []DeadLetter {
+	if letters == nil {
+		return []DeadLetter{}
+	}
+	return letters
+}
+
+// ----- SQLITE DEAD LETTERS
+
+// sqliteDeadLetters keeps the letters in the dead_letters table of the store's
+// database
+type sqliteDeadLetters struct {
+	db *sql.DB
+}
+
+func (sd *sqliteDeadLetters) Add(letter DeadLetter) (ID int64, err error) {
+	alert, err := json.Marshal(letter.Alert)
+	if err != nil {
+		return
+	}
+	result, err := sd.db.Exec("INSERT INTO dead_letters (time, guild_id, subscriber_id, channel, alert, error, attempts) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		letter.Time, letter.GID, letter.SID, letter.Channel, string(alert), letter.Error, letter.Attempts)
+	if err != nil {
+		return
+	}
+	ID, err = result.LastInsertId()
+	if err != nil {
+		return
+	}
+	if limit := deadLetterMax(); limit > 0 {
+		_, err = sd.db.Exec("DELETE FROM dead_letters WHERE id NOT IN (SELECT id FROM dead_letters ORDER BY id DESC LIMIT ?)", limit)
+	}
+	return
+}
+
+func (sd *sqliteDeadLetters) List() (letters []DeadLetter, err error) {
+	rows, err := sd.db.Query("SELECT id, time, guild_id, subscriber_id, channel, alert, error, attempts FROM dead_letters ORDER BY id")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var letter DeadLetter
+		letter, err = scanDeadLetter(rows)
+		if err != nil {
+			return
+		}
+		letters = append(letters, letter)
+	}
+	err = rows.Err()
+	return
+}
+
+func (sd *sqliteDeadLetters) Get(ID int64) (DeadLetter, error) {
+	row := sd.db.QueryRow("SELECT id, time, guild_id, subscriber_id, channel, alert, error, attempts FROM dead_letters WHERE id = ?", ID)
+	letter, err := scanDeadLetter(row)
+	if err == sql.ErrNoRows {
+		return DeadLetter{}, errDeadLetterNotFound
+	}
+	return letter, err
+}
+
+func (sd *sqliteDeadLetters) Remove(ID int64) error {
+	result, err := sd.db.Exec("DELETE FROM dead_letters WHERE id = ?", ID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return errDeadLetterNotFound
+	}
+	return nil
+}
+
+// the database belongs to the store, which closes it
+func (sd *sqliteDeadLetters) Close() error {
+	return nil
+}
+
+func scanDeadLetter(row interface{ Scan(dest ...any) error }) (letter DeadLetter, err error) {
+	var alert string
+	err = row.Scan(&letter.ID, &letter.Time, &letter.GID, &letter.SID, &letter.Channel, &alert, &letter.Error, &letter.Attempts)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(alert), &letter.Alert)
+	if err != nil {
+		err = errors.Wrap(err, "parsing dead letter alert")
+	}
+	return
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/pkg/errors"
+)
+
+// ----- DELIVERY
+
+// retryableError is a failed attempt worth making again, after wait if the
+// receiver asked for one
+type retryableError struct {
+	err  error
+	wait time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+// marks err as worth retrying
+func retryLater(err error, wait time.Duration) error {
+	return &retryableError{err: err, wait: wait}
+}
+
+// how many times a failed delivery is retried, DELIVERY_RETRIES or 4
+func deliveryRetries() int {
+	return envInt("DELIVERY_RETRIES", 4)
+}
+
+// waits 1s, 2s, 4s... up to a minute between attempts
+func deliveryBackoff(attempt int) time.Duration {
+	if attempt > 6 {
+		return time.Minute
+	}
+	return time.Second << attempt
+}
+
+// longest a receiver can ask us to wait before the delivery gives up
+const maxRetryAfter = 5 * time.Minute
+
+// a delivery waiting in its line
+type pendingDelivery struct {
+	dest     destination
+	notifier Notifier
+	alert    Alert
+}
+
+// deliveries waiting for one notifier of one destination
+type deliveryLine struct {
+	waiting []pendingDelivery
+	running bool
+}
+
+var (
+	deliveryLines   = make(map[string]*deliveryLine)
+	deliveryLinesMu sync.Mutex
+)
+
+// identifies a notifier of a destination, two destinations never share a line
+// or a batch
+func deliveryKey(dest destination, notifier Notifier) string {
+	return dest.GID + "/" + dest.SID + "/" + notifier.String()
+}
+
+// hands an alert to its notifier's line. Each line delivers one alert at a
+// time in the order they came, so a later alert never overtakes one that's
+// being retried, and nothing that hands alerts over waits for the retries.
+func dispatch(s *discordgo.Session, dest destination, notifier Notifier, alert Alert) {
+	key := deliveryKey(dest, notifier)
+	deliveryLinesMu.Lock()
+	defer deliveryLinesMu.Unlock()
+	line, exists := deliveryLines[key]
+	if !exists {
+		line = &deliveryLine{}
+		deliveryLines[key] = line
+	}
+	line.waiting = append(line.waiting, pendingDelivery{dest: dest, notifier: notifier, alert: alert})
+	if line.running {
+		return
+	}
+	line.running = true
+	go runDeliveryLine(s, key, line)
+}
+
+// delivers everything in a line, then forgets it. Discord alerts that piled
+// up behind a retry go out together as one batch.
+func runDeliveryLine(s *discordgo.Session, key string, line *deliveryLine) {
+	for {
+		deliveryLinesMu.Lock()
+		if len(line.waiting) == 0 {
+			delete(deliveryLines, key)
+			deliveryLinesMu.Unlock()
+			return
+		}
+		next := line.waiting[0]
+		if next.notifier.Kind() == "discord" && len(line.waiting) > 1 {
+			var alerts []Alert
+			for _, waiting := range line.waiting {
+				alerts = append(alerts, waiting.alert)
+			}
+			next = line.waiting[len(line.waiting)-1]
+			next.alert = batchAlert(alerts)
+			line.waiting = nil
+		} else {
+			line.waiting = line.waiting[1:]
+		}
+		deliveryLinesMu.Unlock()
+		deliver(s, next.dest, next.notifier, next.alert)
+	}
+}
+
+// delivers an alert, dead-lettering it once the retries run out or it fails
+// for good
+func deliver(s *discordgo.Session, dest destination, notifier Notifier, alert Alert) {
+	attempts, err := notifyWithRetries(notifier, alert, deliveryRetries())
+	if err == nil {
+		return
+	}
+	ID, deadErr := deadLetters.Add(DeadLetter{
+		Time:     time.Now().Unix(),
+		GID:      dest.GID,
+		SID:      dest.SID,
+		Channel:  notifier.Kind(),
+		Alert:    alert,
+		Error:    err.Error(),
+		Attempts: attempts,
+	})
+	if deadErr != nil {
+		logMessage(s, "[DELIVERY] error storing dead letter for "+notifier.String()+" |", deadErr)
+		return
+	}
+	logMessage(s, "[DELIVERY] alert to "+notifier.String()+" failed after "+strconv.Itoa(attempts)+" attempts, kept as dead letter #"+strconv.FormatInt(ID, 10)+" |", err)
+}
+
+// notifies until it works, fails for good or has been retried retries times
+func notifyWithRetries(notifier Notifier, alert Alert, retries int) (attempts int, err error) {
+	for {
+		attempts++
+		err = notifier.Notify(alert)
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) || attempts > retries {
+			return
+		}
+		wait := retryable.wait
+		if wait == 0 {
+			wait = deliveryBackoff(attempts - 1)
+		}
+		if wait > maxRetryAfter {
+			return
+		}
+		time.Sleep(wait)
+	}
+}
+
+// sorts discord errors into ones worth retrying and ones that won't go away,
+// like missing permissions or closed DMs
+func classifyDiscordError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var rateLimit *discordgo.RateLimitError
+	if errors.As(err, &rateLimit) {
+		return retryLater(err, rateLimit.RetryAfter)
+	}
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) || restErr.Response == nil {
+		// didn't get an answer at all
+		return retryLater(err, 0)
+	}
+	switch code := restErr.Response.StatusCode; {
+	case code == 429:
+		return retryLater(err, retryAfter(restErr.Response.Header.Get("Retry-After")))
+	case code >= 500:
+		return retryLater(err, 0)
+	}
+	return err
+}
+
+// sorts smtp errors the same way, 4xx replies are temporary
+func classifySmtpError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) && smtpErr.Code >= 500 {
+		return err
+	}
+	return retryLater(err, 0)
+}
+
+// parses a Retry-After header in seconds, 0 if there's none
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// delivers a dead letter again, it's dropped first and comes back under a new
+// ID if it fails again
+func replayDeadLetter(s *discordgo.Session, letter DeadLetter) error {
+	dest := destination{GID: letter.GID, SID: letter.SID}
+	for _, notifier := range destNotifiers(s, dest, letter.Alert.BID) {
+		if notifier.Kind() != letter.Channel {
+			continue
+		}
+		err := deadLetters.Remove(letter.ID)
+		if err != nil {
+			return err
+		}
+		dispatch(s, dest, notifier, letter.Alert)
+		return nil
+	}
+	return errors.New("the destination doesn't get these alerts anymore")
+}
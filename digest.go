@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ----- DIGESTS
+
+// bots listed in a digest, the most an embed has fields for minus the worst
+// offenders field
+const maxDigestBots = 24
+
+// the start of the current period of a cadence, digests are due at midnight
+// UTC, on mondays for weekly ones and on the 1st for monthly ones
+func digestPeriodStart(cadence string, now time.Time) time.Time {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch cadence {
+	case "weekly":
+		return today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	case "monthly":
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return today
+}
+
+// the period before the one starting at start
+func digestPreviousPeriod(cadence string, start time.Time) time.Time {
+	switch cadence {
+	case "weekly":
+		return start.AddDate(0, 0, -7)
+	case "monthly":
+		return start.AddDate(0, -1, 0)
+	}
+	return start.AddDate(0, 0, -1)
+}
+
+// when the next digest is due
+func digestNextPeriod(cadence string, now time.Time) time.Time {
+	start := digestPeriodStart(cadence, now)
+	switch cadence {
+	case "weekly":
+		return start.AddDate(0, 0, 7)
+	case "monthly":
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// sends every digest that's due, called every minute
+func runDigests(s *discordgo.Session) {
+	guilds, err := store.ListGuilds()
+	if err != nil {
+		logMessage(s, "[DIGEST] error getting guild map |", err)
+		return
+	}
+	now := time.Now()
+	for _, guild := range guilds {
+		digest := guild.Settings.Digest
+		if digest.Cadence == "" {
+			continue
+		}
+		end := digestPeriodStart(digest.Cadence, now)
+		if digest.LastSent >= end.Unix() {
+			continue
+		}
+		// record first so a failing channel doesn't get retried every minute
+		err = addToQueue(DigestSent{GID: guild.ID, Time: now.Unix()})
+		if err != nil {
+			logMessage(s, "[DIGEST] error queueing action |", err)
+			continue
+		}
+		go sendDigest(s, guild, digestPreviousPeriod(digest.Cadence, end), end)
+	}
+}
+
+// posts a digest of start to end in the guild's channel
+func sendDigest(s *discordgo.Session, guild Guild, start time.Time, end time.Time) {
+	message, err := makeDigest(s, guild, start, end)
+	if err != nil {
+		logMessage(s, "[DIGEST] error making digest |", err)
+		return
+	}
+	_, err = s.ChannelMessageSendComplex(guild.CID, message)
+	if err != nil {
+		logMessage(s, "[DIGEST] digest failed to send |", err)
+	}
+}
+
+// a bot's part of a digest
+type digestEntry struct {
+	name   string
+	report uptimeReport
+	row    []float64
+}
+
+// makes a digest of every bot watched in a guild, with a daily chart
+func makeDigest(s *discordgo.Session, guild Guild, start time.Time, end time.Time) (*discordgo.MessageSend, error) {
+	var entries []digestEntry
+	for _, BID := range guild.Bots {
+		bot, err := store.GetBot(BID)
+		if err != nil {
+			continue
+		}
+		events, err := history.Events(BID, time.Unix(0, 0))
+		if err != nil {
+			return nil, err
+		}
+		name := "<@" + BID + ">"
+		if discordBot, err := guildUser(s, guild.ID, BID); err == nil {
+			name = discordBot.Username
+		}
+		// spans up to end, so a digest sent late still covers its own period
+		var spans []statusSpan
+		for _, span := range statusSpans(bot, events, time.Now()) {
+			if span.start.Before(end) {
+				if span.end.After(end) {
+					span.end = end
+					span.ongoing = true
+				}
+				spans = append(spans, span)
+			}
+		}
+		days := int(end.Sub(start).Hours()/24 + 0.5)
+		entries = append(entries, digestEntry{
+			name:   name,
+			report: makeUptimeReport(spans, end, end.Sub(start)),
+			row:    bucketAvailability(spans, end, 24*time.Hour, days),
+		})
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Availability digest",
+		Description: fmt.Sprintf("From <t:%d:f> to <t:%d:f>", start.Unix(), end.Unix()),
+		Color:       defaultColor,
+		Timestamp:   end.UTC().Format(time.RFC3339),
+	}
+	if len(entries) == 0 {
+		embed.Description += "\nNo bots are being watched in this server"
+		return &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}}, nil
+	}
+
+	// worst offenders, least available first
+	var worst []digestEntry
+	for _, entry := range entries {
+		if entry.report.down > 0 {
+			worst = append(worst, entry)
+		}
+	}
+	sort.SliceStable(worst, func(i, j int) bool {
+		if worst[i].report.availability() != worst[j].report.availability() {
+			return worst[i].report.availability() < worst[j].report.availability()
+		}
+		return worst[i].report.down > worst[j].report.down
+	})
+	offenders := ""
+	for n, entry := range worst {
+		if n == 3 {
+			break
+		}
+		offenders += fmt.Sprintf("%d. %s\n%s%% | %d OUTAGES | %s DOWN\n", n+1, entry.name, strconv.FormatFloat(entry.report.availability(), 'f', 2, 64), entry.report.outages, formatDuration(entry.report.down))
+	}
+	if offenders == "" {
+		offenders = "Nothing went offline\n"
+	}
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Worst offenders", Value: "```" + offenders + "```"})
+
+	var rows [][]float64
+	for n, entry := range entries {
+		if n == maxDigestBots {
+			embed.Description += fmt.Sprintf("\nShowing the first %d of %d bots", maxDigestBots, len(entries))
+			break
+		}
+		value := "```NO HISTORY```"
+		if entry.report.covered > 0 {
+			value = "```" + strconv.FormatFloat(entry.report.availability(), 'f', 2, 64) + "%\nOUTAGES\n" + strconv.Itoa(entry.report.outages) + "\nDOWNTIME\n" + formatDuration(entry.report.down) + "```"
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: entry.name, Value: value, Inline: true})
+		rows = append(rows, entry.row)
+	}
+
+	message := &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}}
+	chart, err := attachChart(embed, rows)
+	if err != nil {
+		return nil, err
+	}
+	message.Files = []*discordgo.File{chart}
+	return message, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ----- EMAIL
+
+// how long a verification code can be used
+const emailCodeLifetime = time.Hour
+
+// how long to wait before sending another verification code
+const emailCodeCooldown = time.Minute
+
+// smtp settings from the environment
+type smtpConfig struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+// reads SMTP_HOST, SMTP_PORT (587 by default), SMTP_USERNAME, SMTP_PASSWORD
+// and SMTP_FROM, email is off unless SMTP_HOST and SMTP_FROM are set
+func loadSmtpConfig() (config smtpConfig, enabled bool) {
+	config = smtpConfig{
+		host:     os.Getenv("SMTP_HOST"),
+		port:     os.Getenv("SMTP_PORT"),
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     os.Getenv("SMTP_FROM"),
+	}
+	if config.port == "" {
+		config.port = "587"
+	}
+	return config, config.host != "" && config.from != ""
+}
+
+// sends a plain text email, upgrading to TLS when the server offers it.
+// Credentials are only ever sent over TLS or to localhost.
+func sendEmail(to string, subject string, body string) error {
+	config, enabled := loadSmtpConfig()
+	if !enabled {
+		return errors.New("email isn't set up")
+	}
+	var auth smtp.Auth
+	if config.username != "" {
+		auth = smtp.PlainAuth("", config.username, config.password, config.host)
+	}
+	message := "From: OfflineNotifier <" + config.from + ">\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + mimeHeader(subject) + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		strings.ReplaceAll(body, "\n", "\r\n")
+	return smtp.SendMail(net.JoinHostPort(config.host, config.port), auth, config.from, []string{to}, []byte(message))
+}
+
+// encodes a header value that might not be plain ascii
+func mimeHeader(text string) string {
+	text = strings.NewReplacer("\r", "", "\n", " ").Replace(text)
+	for _, r := range text {
+		if r > 127 {
+			return "=?utf-8?q?" + qEncode(text) + "?="
+		}
+	}
+	return text
+}
+
+func qEncode(text string) (encoded string) {
+	for _, b := range []byte(text) {
+		switch {
+		case b == ' ':
+			encoded += "_"
+		case b > 127 || b == '=' || b == '?' || b == '_':
+			encoded += fmt.Sprintf("=%02X", b)
+		default:
+			encoded += string(b)
+		}
+	}
+	return
+}
+
+// checks an address and returns it without any display name
+func parseEmail(text string) (string, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(text))
+	if err != nil {
+		return "", errors.New("invalid email address")
+	}
+	return address.Address, nil
+}
+
+// makes a 6 digit verification code
+func newEmailCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// codes are only kept hashed
+func hashEmailCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// wrong codes allowed before a new one has to be sent
+const maxEmailAttempts = 5
+
+// wrong codes entered since each subscriber's last code was sent
+var (
+	emailAttempts   = make(map[string]int)
+	emailAttemptsMu sync.Mutex
+)
+
+// counts an attempt at a code, false once there have been too many
+func checkEmailAttempt(SID string) bool {
+	emailAttemptsMu.Lock()
+	defer emailAttemptsMu.Unlock()
+	emailAttempts[SID]++
+	return emailAttempts[SID] <= maxEmailAttempts
+}
+
+func resetEmailAttempts(SID string) {
+	emailAttemptsMu.Lock()
+	defer emailAttemptsMu.Unlock()
+	delete(emailAttempts, SID)
+}
+
+var (
+	errNoEmailCode      = errors.New("no verification code was sent")
+	errEmailCodeExpired = errors.New("verification code expired")
+	errEmailCodeWrong   = errors.New("wrong verification code")
+)
+
+// checks a code against the one last sent to a subscriber, counting the
+// attempt. Once the code is too old or has been guessed at too often it
+// counts as expired.
+func checkEmailCode(SID string, email EmailSettings, code string, now time.Time) error {
+	if email.CodeHash == "" {
+		return errNoEmailCode
+	}
+	if now.Sub(time.Unix(email.CodeSent, 0)) > emailCodeLifetime || !checkEmailAttempt(SID) {
+		return errEmailCodeExpired
+	}
+	if subtle.ConstantTimeCompare([]byte(hashEmailCode(code)), []byte(email.CodeHash)) != 1 {
+		return errEmailCodeWrong
+	}
+	return nil
+}
+
+// sends the code that confirms a subscriber owns an address
+func sendEmailCode(address string, code string) error {
+	return sendEmail(address, "Your OfflineNotifier verification code",
+		"Your verification code is "+code+"\n\n"+
+			"Use /notify verify in Discord within an hour to get alerts about the bots you're subscribed to at this address.\n"+
+			"If you didn't ask for this, you can ignore this email.\n")
+}
+
+// the email version of an alert, with the same content as the embed
+func alertEmail(alert Alert) (subject string, body string) {
+	embed := alertEmbed(alert)
+	body = embed.Title + "\n\n" + strings.TrimSpace(strings.ReplaceAll(embed.Description, "```", "")) + "\n\n" +
+		alert.Time.UTC().Format("2006-01-02 15:04:05 MST") + "\n\n" +
+		"You're getting this because you subscribed to " + alert.Name + " with /notify subscribe.\n" +
+		"Use /notify email without an address to stop these emails.\n"
+	return embed.Title, body
+}
+
+// emailNotifier emails alerts to a subscriber's verified address
+type emailNotifier struct {
+	address string
+}
+
+func (en *emailNotifier) Notify(alert Alert) error {
+	subject, body := alertEmail(alert)
+	return classifySmtpError(sendEmail(en.address, subject, body))
+}
+
+func (en *emailNotifier) Kind() string {
+	return "email"
+}
+
+func (en *emailNotifier) String() string {
+	return "email " + en.address
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// an email the fake server took
+type fakeEmail struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSmtp is just enough of an smtp server for smtp.SendMail, without TLS or
+// auth. RCPT TO gets rcptReply, so tests can make the server refuse mail.
+type fakeSmtp struct {
+	listener  net.Listener
+	rcptReply string
+	mu        sync.Mutex
+	emails    []fakeEmail
+}
+
+// starts a fake server and points the SMTP_ settings at it
+func startFakeSmtp(t *testing.T, rcptReply string) *fakeSmtp {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	fs := &fakeSmtp{listener: listener, rcptReply: rcptReply}
+	go fs.serve()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	t.Setenv("SMTP_HOST", host)
+	t.Setenv("SMTP_PORT", port)
+	t.Setenv("SMTP_USERNAME", "")
+	t.Setenv("SMTP_PASSWORD", "")
+	t.Setenv("SMTP_FROM", "alerts@example.com")
+	return fs
+}
+
+func (fs *fakeSmtp) serve() {
+	for {
+		conn, err := fs.listener.Accept()
+		if err != nil {
+			return
+		}
+		go fs.handle(conn)
+	}
+}
+
+func (fs *fakeSmtp) handle(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 fake ESMTP")
+	var email fakeEmail
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			text.PrintfLine("250 fake")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			email = fakeEmail{from: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			text.PrintfLine("250 ok")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			if fs.rcptReply != "" {
+				text.PrintfLine("%s", fs.rcptReply)
+				continue
+			}
+			email.to = append(email.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			text.PrintfLine("250 ok")
+		case command == "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			email.data = string(data)
+			fs.mu.Lock()
+			fs.emails = append(fs.emails, email)
+			fs.mu.Unlock()
+			text.PrintfLine("250 ok")
+		case command == "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 ok")
+		}
+	}
+}
+
+// the one email the server took
+func (fs *fakeSmtp) onlyEmail(t *testing.T) (fakeEmail, *mail.Message) {
+	t.Helper()
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if len(fs.emails) != 1 {
+		t.Fatalf("server got %d emails, want 1", len(fs.emails))
+	}
+	message, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(fs.emails[0].data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs.emails[0], message
+}
+
+// checks the envelope and headers of an email, and returns its body
+func checkEmail(t *testing.T, fs *fakeSmtp, to string, subject string) string {
+	t.Helper()
+	email, message := fs.onlyEmail(t)
+	if email.from != "alerts@example.com" {
+		t.Errorf("MAIL FROM = %q", email.from)
+	}
+	if len(email.to) != 1 || email.to[0] != to {
+		t.Errorf("RCPT TO = %q", email.to)
+	}
+	if from := message.Header.Get("From"); from != "OfflineNotifier <alerts@example.com>" {
+		t.Errorf("From = %q", from)
+	}
+	if got := message.Header.Get("To"); got != to {
+		t.Errorf("To = %q", got)
+	}
+	got, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != subject {
+		t.Errorf("Subject = %q, want %q", got, subject)
+	}
+	body, err := io.ReadAll(message.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestSendEmailCode(t *testing.T) {
+	fs := startFakeSmtp(t, "")
+	err := sendEmailCode("someone@example.com", "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := checkEmail(t, fs, "someone@example.com", "Your OfflineNotifier verification code")
+	if !strings.Contains(body, "Your verification code is 123456\n") {
+		t.Errorf("body doesn't have the code:\n%s", body)
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	fs := startFakeSmtp(t, "")
+	notifier := &emailNotifier{address: "someone@example.com"}
+	alert := Alert{Kind: "offline", BID: "1", Name: "Robot ✨", Time: time.Now(), Duration: 90 * time.Minute}
+	err := notifier.Notify(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := checkEmail(t, fs, "someone@example.com", "Robot ✨ is now offline")
+	for _, want := range []string{"Robot ✨ is now offline\n", "TOTAL UPTIME", "subscribed to Robot ✨"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body doesn't have %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestClassifySmtpError(t *testing.T) {
+	for _, test := range []struct {
+		reply     string
+		retryable bool
+	}{
+		{"451 try again later", true},
+		{"550 no such user", false},
+	} {
+		startFakeSmtp(t, test.reply)
+		notifier := &emailNotifier{address: "someone@example.com"}
+		err := notifier.Notify(Alert{Kind: "online", Name: "Robot", Time: time.Now()})
+		if err == nil {
+			t.Fatalf("%s: Notify worked", test.reply)
+		}
+		var retryable *retryableError
+		if errors.As(err, &retryable) != test.retryable {
+			t.Errorf("%s: retryable = %v, want %v (%v)", test.reply, !test.retryable, test.retryable, err)
+		}
+	}
+}
+
+func TestCheckEmailCode(t *testing.T) {
+	now := time.Now()
+	email := EmailSettings{Address: "someone@example.com", CodeHash: hashEmailCode("123456"), CodeSent: now.Unix()}
+
+	SID := "wrong"
+	t.Cleanup(func() { resetEmailAttempts(SID) })
+	if err := checkEmailCode(SID, email, "654321", now); err != errEmailCodeWrong {
+		t.Errorf("wrong code: %v", err)
+	}
+	if err := checkEmailCode(SID, email, " 123456 ", now); err != nil {
+		t.Errorf("right code: %v", err)
+	}
+
+	expired := email
+	expired.CodeSent = now.Add(-emailCodeLifetime - time.Minute).Unix()
+	if err := checkEmailCode("expired", expired, "123456", now); err != errEmailCodeExpired {
+		t.Errorf("expired code: %v", err)
+	}
+	resetEmailAttempts("expired")
+
+	if err := checkEmailCode("none", EmailSettings{}, "123456", now); err != errNoEmailCode {
+		t.Errorf("no code: %v", err)
+	}
+}
+
+func TestCheckEmailCodeAttemptLimit(t *testing.T) {
+	now := time.Now()
+	email := EmailSettings{Address: "someone@example.com", CodeHash: hashEmailCode("123456"), CodeSent: now.Unix()}
+	SID := "guesser"
+	t.Cleanup(func() { resetEmailAttempts(SID) })
+	for n := 0; n < maxEmailAttempts; n++ {
+		if err := checkEmailCode(SID, email, "000000", now); err != errEmailCodeWrong {
+			t.Fatalf("guess %d: %v", n+1, err)
+		}
+	}
+	// the right code is refused once the guesses are used up
+	if err := checkEmailCode(SID, email, "123456", now); err != errEmailCodeExpired {
+		t.Errorf("after %d guesses: %v", maxEmailAttempts, err)
+	}
+}
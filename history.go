@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ----- HISTORY
+
+// StatusEvent is a recorded status change of a bot
+type StatusEvent struct {
+	BID      string `json:"bot"`
+	Previous string `json:"previous"`
+	Status   string `json:"status"`
+	// unix time of the change
+	Time int64 `json:"time"`
+	// guilds watching the bot when the change was seen
+	Guilds []string `json:"guilds"`
+}
+
+// History keeps every status change of every bot, within the retention limits
+type History interface {
+	Record(event StatusEvent) error
+	// events of a bot at or after since, oldest first
+	Events(BID string, since time.Time) ([]StatusEvent, error)
+	// drops events older than before and all but the newest maxPerBot of each bot
+	Prune(before time.Time, maxPerBot int) error
+	Close() error
+}
+
+// opens the history next to the store, sqlite stores keep it in a table and
+// json stores in a file of its own
+func openHistory(st Store) (History, error) {
+	if ss, ok := st.(*sqliteStore); ok {
+		return &sqliteHistory{db: ss.db}, nil
+	}
+	return openJsonHistory(historyPath())
+}
+
+// path of the json history, HISTORY_PATH or history.jsonl
+func historyPath() string {
+	path := os.Getenv("HISTORY_PATH")
+	if path == "" {
+		path = "history.jsonl"
+	}
+	return path
+}
+
+// how long events are kept, HISTORY_RETENTION or 90 days
+func historyRetention() time.Duration {
+	return envDuration("HISTORY_RETENTION", 90*24*time.Hour)
+}
+
+// how many events are kept per bot, HISTORY_MAX_EVENTS or 1000 (0 for no limit)
+func historyMaxEvents() int {
+	return envInt("HISTORY_MAX_EVENTS", 1000)
+}
+
+// records a status change, the history is only a record so failures are
+// logged rather than stopping the change
+func recordStatus(BID string, previous string, status string, guilds []string) {
+	err := history.Record(StatusEvent{
+		BID:      BID,
+		Previous: previous,
+		Status:   status,
+		Time:     time.Now().Unix(),
+		Guilds:   copyIDs(guilds),
+	})
+	if err != nil {
+		log.Println("[HISTORY] error recording status change |", err)
+	}
+}
+
+// applies the retention limits
+func pruneHistory() {
+	err := history.Prune(time.Now().Add(-historyRetention()), historyMaxEvents())
+	if err != nil {
+		log.Println("[HISTORY] error pruning history |", err)
+	}
+}
+
+// ----- JSON HISTORY
+
+// jsonHistory appends events to a jsonl file and keeps them in memory
+type jsonHistory struct {
+	path   string
+	mu     sync.Mutex
+	file   *os.File
+	events []StatusEvent
+}
+
+func openJsonHistory(path string) (*jsonHistory, error) {
+	jh := &jsonHistory{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var event StatusEvent
+		err = json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			// a crash mid-append only ever breaks the last line
+			log.Println("[HISTORY] stopping at unreadable event |", err)
+			break
+		}
+		jh.events = append(jh.events, event)
+	}
+	sort.SliceStable(jh.events, func(i, j int) bool { return jh.events[i].Time < jh.events[j].Time })
+
+	// rewrite so a broken tail doesn't get appended to
+	err = jh.rewrite()
+	if err != nil {
+		return nil, err
+	}
+	return jh, nil
+}
+
+func (jh *jsonHistory) Record(event StatusEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	jh.mu.Lock()
+	defer jh.mu.Unlock()
+	_, err = jh.file.Write(append(line, '\n'))
+	if err != nil {
+		return errors.Wrap(err, "writing history")
+	}
+	// keep events in time order even if the clock went backwards
+	i := sort.Search(len(jh.events), func(i int) bool { return jh.events[i].Time > event.Time })
+	jh.events = append(jh.events, StatusEvent{})
+	copy(jh.events[i+1:], jh.events[i:])
+	jh.events[i] = event
+	return nil
+}
+
+func (jh *jsonHistory) Events(BID string, since time.Time) (events []StatusEvent, err error) {
+	jh.mu.Lock()
+	defer jh.mu.Unlock()
+	for _, event := range jh.events {
+		if event.BID == BID && event.Time >= since.Unix() {
+			event.Guilds = copyIDs(event.Guilds)
+			events = append(events, event)
+		}
+	}
+	return
+}
+
+func (jh *jsonHistory) Prune(before time.Time, maxPerBot int) error {
+	jh.mu.Lock()
+	defer jh.mu.Unlock()
+
+	// walk backwards so the newest events of each bot are the ones counted
+	kept := make(map[string]int)
+	var events []StatusEvent
+	for i := len(jh.events) - 1; i >= 0; i-- {
+		event := jh.events[i]
+		if event.Time < before.Unix() || (maxPerBot > 0 && kept[event.BID] >= maxPerBot) {
+			continue
+		}
+		kept[event.BID]++
+		events = append(events, event)
+	}
+	if len(events) == len(jh.events) {
+		return nil
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	jh.events = events
+	return jh.rewrite()
+}
+
+// atomically replaces the history file with the events in memory
+func (jh *jsonHistory) rewrite() error {
+	var buf bytes.Buffer
+	for _, event := range jh.events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	tmp, err := writeTempFile(jh.path, buf.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "writing history")
+	}
+	defer os.Remove(tmp)
+	err = os.Rename(tmp, jh.path)
+	if err != nil {
+		return err
+	}
+	err = syncDir(filepath.Dir(jh.path))
+	if err != nil {
+		return err
+	}
+
+	if jh.file != nil {
+		jh.file.Close()
+	}
+	jh.file, err = os.OpenFile(jh.path, os.O_WRONLY|os.O_APPEND, 0644)
+	return err
+}
+
+func (jh *jsonHistory) Close() error {
+	jh.mu.Lock()
+	defer jh.mu.Unlock()
+	return jh.file.Close()
+}
+
+// ----- SQLITE HISTORY
+
+// sqliteHistory keeps events in the status_events table of the store's database
+type sqliteHistory struct {
+	db *sql.DB
+}
+
+func (sh *sqliteHistory) Record(event StatusEvent) error {
+	guilds, err := json.Marshal(nonNil(event.Guilds))
+	if err != nil {
+		return err
+	}
+	_, err = sh.db.Exec("INSERT INTO status_events (bot_id, previous, status, time, guilds) VALUES (?, ?, ?, ?, ?)",
+		event.BID, event.Previous, event.Status, event.Time, string(guilds))
+	return err
+}
+
+func (sh *sqliteHistory) Events(BID string, since time.Time) (events []StatusEvent, err error) {
+	rows, err := sh.db.Query("SELECT previous, status, time, guilds FROM status_events WHERE bot_id = ? AND time >= ? ORDER BY time, id", BID, since.Unix())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		event := StatusEvent{BID: BID}
+		var guilds string
+		err = rows.Scan(&event.Previous, &event.Status, &event.Time, &guilds)
+		if err != nil {
+			return
+		}
+		err = json.Unmarshal([]byte(guilds), &event.Guilds)
+		if err != nil {
+			err = errors.Wrap(err, "parsing guilds of status event")
+			return
+		}
+		events = append(events, event)
+	}
+	err = rows.Err()
+	return
+}
+
+func (sh *sqliteHistory) Prune(before time.Time, maxPerBot int) error {
+	_, err := sh.db.Exec("DELETE FROM status_events WHERE time < ?", before.Unix())
+	if err != nil || maxPerBot <= 0 {
+		return err
+	}
+	_, err = sh.db.Exec(`DELETE FROM status_events WHERE id IN (
+		SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY bot_id ORDER BY time DESC, id DESC) AS n FROM status_events
+		) WHERE n > ?
+	)`, maxPerBot)
+	return err
+}
+
+// replaces the events in the sqlite store with those of a json history
+func (ss *sqliteStore) importHistory(path string) (count int, err error) {
+	jh, err := openJsonHistory(path)
+	if err != nil {
+		return
+	}
+	defer jh.Close()
+	err = ss.transaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM status_events")
+		if err != nil {
+			return err
+		}
+		for _, event := range jh.events {
+			guilds, err := json.Marshal(nonNil(event.Guilds))
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("INSERT INTO status_events (bot_id, previous, status, time, guilds) VALUES (?, ?, ?, ?, ?)",
+				event.BID, event.Previous, event.Status, event.Time, string(guilds))
+			if err != nil {
+				return errors.Wrap(err, "importing status event")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	count = len(jh.events)
+	return
+}
+
+// the database belongs to the store, which closes it
+func (sh *sqliteHistory) Close() error {
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ----- JOURNAL
+
+// journalEntry is one line of the journal
+type journalEntry struct {
+	Seq    uint64          `json:"seq"`
+	Type   string          `json:"type"`
+	Data   json.RawMessage `json:"data"`
+	action Action
+}
+
+// journal is a write-ahead log of queued actions. An action is synced to the
+// journal before it's acknowledged, and dropped once the state it produced
+// has been flushed to the store.
+type journal struct {
+	path    string
+	mu      sync.Mutex
+	file    *os.File
+	next    uint64
+	entries []journalEntry
+}
+
+// decoders for every action type that can be journaled
+var actionTypes = map[string]func(data json.RawMessage) (Action, error){
+	"AssignChannel":      decodeAction[AssignChannel],
+	"RemoveGuild":        decodeAction[RemoveGuild],
+	"SetStatus":          decodeAction[SetStatus],
+	"AddBot":             decodeAction[AddBot],
+	"RemoveBot":          decodeAction[RemoveBot],
+	"AddSubscriber":      decodeAction[AddSubscriber],
+	"RemoveSubscriber":   decodeAction[RemoveSubscriber],
+	"SetGracePeriod":     decodeAction[SetGracePeriod],
+	"SetNotify":          decodeAction[SetNotify],
+	"SetDigest":          decodeAction[SetDigest],
+	"DigestSent":         decodeAction[DigestSent],
+	"SetRoute":           decodeAction[SetRoute],
+	"SetWatchList":       decodeAction[SetWatchList],
+	"SetExplicitOnly":    decodeAction[SetExplicitOnly],
+	"SetMention":         decodeAction[SetMention],
+	"SetMentionRecovery": decodeAction[SetMentionRecovery],
+	"SetTemplate":        decodeAction[SetTemplate],
+	"SetWebhook":         decodeAction[SetWebhook],
+	"SetEmail":           decodeAction[SetEmail],
+	"VerifyEmail":        decodeAction[VerifyEmail],
+	"SetBoard":           decodeAction[SetBoard],
+}
+
+func decodeAction[T Action](data json.RawMessage) (Action, error) {
+	var action T
+	err := json.Unmarshal(data, &action)
+	return action, err
+}
+
+// path of the journal, JOURNAL_PATH or journal.jsonl
+func journalPath() string {
+	path := os.Getenv("JOURNAL_PATH")
+	if path == "" {
+		path = "journal.jsonl"
+	}
+	return path
+}
+
+// opens the journal at path and reads back every entry that wasn't compacted
+func openJournal(path string) (*journal, error) {
+	j := &journal{path: path, next: 1}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			// a crash mid-append only ever breaks the last line
+			log.Println("[JOURNAL] stopping at unreadable entry |", err)
+			break
+		}
+		decode, exists := actionTypes[entry.Type]
+		if !exists {
+			log.Println("[JOURNAL] skipping unknown action type |", entry.Type)
+			continue
+		}
+		entry.action, err = decode(entry.Data)
+		if err != nil {
+			log.Println("[JOURNAL] skipping undecodable action |", err)
+			continue
+		}
+		j.entries = append(j.entries, entry)
+		if entry.Seq >= j.next {
+			j.next = entry.Seq + 1
+		}
+	}
+
+	// rewrite so a broken tail doesn't get appended to
+	err = j.rewrite()
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// entries that still have to be applied
+func (j *journal) pending() []journalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]journalEntry{}, j.entries...)
+}
+
+// syncs an action to the journal and then hands it to queue. Both happen
+// under the lock so entries reach the queue in seq order.
+func (j *journal) append(action Action, queue chan<- journalEntry) (err error) {
+	data, err := json.Marshal(action)
+	if err != nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry := journalEntry{
+		Seq:    j.next,
+		Type:   reflect.TypeOf(action).Name(),
+		Data:   data,
+		action: action,
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	_, err = j.file.Write(append(line, '\n'))
+	if err == nil {
+		err = j.file.Sync()
+	}
+	if err != nil {
+		err = errors.Wrap(err, "writing journal")
+		return
+	}
+	j.next++
+	j.entries = append(j.entries, entry)
+	queue <- entry
+	return
+}
+
+// drops every entry up to and including seq
+func (j *journal) compact(seq uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	i := 0
+	for i < len(j.entries) && j.entries[i].Seq <= seq {
+		i++
+	}
+	if i == 0 {
+		return nil
+	}
+	j.entries = j.entries[i:]
+	return j.rewrite()
+}
+
+// atomically replaces the journal file with the entries left in memory
+func (j *journal) rewrite() error {
+	var buf bytes.Buffer
+	for _, entry := range j.entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	tmp, err := writeTempFile(j.path, buf.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "writing journal")
+	}
+	defer os.Remove(tmp)
+	err = os.Rename(tmp, j.path)
+	if err != nil {
+		return err
+	}
+	err = syncDir(filepath.Dir(j.path))
+	if err != nil {
+		return err
+	}
+
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file, err = os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0644)
+	return err
+}
+
+func (j *journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
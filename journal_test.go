@@ -0,0 +1,250 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// sets up a json store, the state cache over it and a journal in a temp dir,
+// like main does. The flusher only runs when a test calls Flush.
+func openJournalTest(t *testing.T, dir string) {
+	t.Helper()
+	dataPath := filepath.Join(dir, "data.json")
+	if _, err := os.Stat(dataPath); os.IsNotExist(err) {
+		err = os.WriteFile(dataPath, []byte("{}"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var err error
+	actionJournal, err = openJournal(filepath.Join(dir, "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	actionQueue = make(chan journalEntry, 64)
+	compact := func(mark uint64) {
+		err := actionJournal.compact(mark)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	state, err = newCachedStore(newJsonStore(dataPath, 0), time.Hour, compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store = state
+}
+
+// stops everything openJournalTest started, as a clean shutdown would
+func closeJournalTest(t *testing.T) {
+	t.Helper()
+	err := state.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = actionJournal.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// applies whatever is waiting in the queue
+func drainQueue() {
+	for {
+		select {
+		case entry := <-actionQueue:
+			applyEntry(nil, entry)
+		default:
+			return
+		}
+	}
+}
+
+func pendingSeqs(j *journal) (seqs []uint64) {
+	for _, entry := range j.pending() {
+		seqs = append(seqs, entry.Seq)
+	}
+	return
+}
+
+func equalSeqs(a []uint64, b ...uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for n := range a {
+		if a[n] != b[n] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestJournalTornLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	data := `{"seq":1,"type":"AssignChannel","data":{"GID":"1","CID":"2"}}
+{"seq":2,"type":"AddBot","data":{"GID":"1","BID":"3"}}
+{"seq":3,"type":"SetStat`
+	err := os.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := openJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seqs := pendingSeqs(j); !equalSeqs(seqs, 1, 2) {
+		t.Fatalf("pending after a torn line = %v, want [1 2]", seqs)
+	}
+	// the next append goes after the good lines, not after the torn one
+	err = j.append(SetStatus{BID: "3", Status: "online"}, make(chan journalEntry, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	j, err = openJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if seqs := pendingSeqs(j); !equalSeqs(seqs, 1, 2, 3) {
+		t.Fatalf("pending after reopening = %v, want [1 2 3]", seqs)
+	}
+	if action, ok := j.pending()[2].action.(SetStatus); !ok || action.BID != "3" {
+		t.Errorf("third entry = %+v", j.pending()[2].action)
+	}
+}
+
+func TestJournalSeqContinuesAfterReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := openJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := make(chan journalEntry, 3)
+	for _, GID := range []string{"1", "2", "3"} {
+		err = j.append(AssignChannel{GID: GID, CID: "9"}, queue)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = j.compact(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	j, err = openJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if seqs := pendingSeqs(j); !equalSeqs(seqs, 3) {
+		t.Fatalf("pending = %v, want [3]", seqs)
+	}
+	queue = make(chan journalEntry, 1)
+	err = j.append(AssignChannel{GID: "4", CID: "9"}, queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := <-queue; entry.Seq != 4 {
+		t.Errorf("seq after reopening = %d, want 4", entry.Seq)
+	}
+}
+
+func TestJournalCompactsUpToFlushedMark(t *testing.T) {
+	openJournalTest(t, t.TempDir())
+	defer closeJournalTest(t)
+
+	for _, action := range []Action{AssignChannel{GID: "1", CID: "2"}, AddBot{GID: "1", BID: "3"}} {
+		err := addToQueue(action)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// only the first action is applied before the flush
+	applyEntry(nil, <-actionQueue)
+	err := state.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seqs := pendingSeqs(actionJournal); !equalSeqs(seqs, 2) {
+		t.Fatalf("pending after flushing the first action = %v, want [2]", seqs)
+	}
+
+	drainQueue()
+	err = state.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seqs := pendingSeqs(actionJournal); len(seqs) != 0 {
+		t.Fatalf("pending after flushing everything = %v, want none", seqs)
+	}
+	data, err := os.ReadFile(actionJournal.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Errorf("journal file still has %q", data)
+	}
+}
+
+func TestReplayJournalAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	openJournalTest(t, dir)
+	changed := time.Now().Add(-time.Hour).Unix()
+	for _, action := range []Action{
+		AssignChannel{GID: "1", CID: "2"},
+		AddBot{GID: "1", BID: "3"},
+		SetStatus{BID: "3", Status: "offline", ChangeTimestamp: true, Time: changed},
+	} {
+		err := addToQueue(action)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// crash before anything is applied or flushed, the journal is all there is
+	actionJournal.Close()
+
+	openJournalTest(t, dir)
+	defer closeJournalTest(t)
+	if seqs := pendingSeqs(actionJournal); !equalSeqs(seqs, 1, 2, 3) {
+		t.Fatalf("pending after the crash = %v, want [1 2 3]", seqs)
+	}
+	replayJournal(nil)
+
+	if seqs := pendingSeqs(actionJournal); len(seqs) != 0 {
+		t.Errorf("pending after replaying = %v, want none", seqs)
+	}
+	// replaying flushes, so the backing file has everything
+	doc, err := readJsonDocument(filepath.Join(dir, "data.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	guild, exists := doc.Guilds["1"]
+	if !exists || guild.CID != "2" || !equalIDs(guild.Bots, "3") {
+		t.Errorf("guild = %+v", guild)
+	}
+	bot, exists := doc.Bots["3"]
+	if !exists || bot.Status != "offline" {
+		t.Fatalf("bot = %+v", bot)
+	}
+	// the change keeps the time it happened, not the time of the replay
+	if bot.Timestamp != changed {
+		t.Errorf("bot timestamp = %d, want %d", bot.Timestamp, changed)
+	}
+}
+
+func equalIDs(IDs []string, want ...string) bool {
+	if len(IDs) != len(want) {
+		return false
+	}
+	for n := range IDs {
+		if IDs[n] != want[n] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ----- MENTIONS
+
+// whether an alert should ping anyone, offline alerts always do and recovery
+// alerts only when asked for
+func mentionsAlert(alert Alert, recovery bool) bool {
+	switch alert.Kind {
+	case "offline", "flapping":
+		return true
+	case "online":
+		return recovery
+	case "stable":
+		return recovery || alert.Status == "offline"
+	}
+	return false
+}
+
+// the roles and users to ping about an alert in a guild, the guild's mentions
+// plus the bot's own
+func alertMentions(guild Guild, alert Alert) (roles []string, users []string) {
+	if alert.Kind == "batch" {
+		for _, a := range alert.Alerts {
+			alertRoles, alertUsers := alertMentions(guild, a)
+			roles = addIDs(roles, alertRoles)
+			users = addIDs(users, alertUsers)
+		}
+		return
+	}
+	mentions := guild.Settings.Mentions
+	botMentions := guild.Settings.BotMentions[alert.BID]
+	if !mentionsAlert(alert, mentions.Recovery || botMentions.Recovery) {
+		return
+	}
+	for _, set := range []MentionSettings{mentions, botMentions} {
+		roles = addIDs(roles, set.Roles)
+		users = addIDs(users, set.Users)
+	}
+	return
+}
+
+// adds the IDs that aren't in a list yet
+func addIDs(list []string, IDs []string) []string {
+	for _, ID := range IDs {
+		if _, err := indexID(list, ID); err != nil {
+			list = append(list, ID)
+		}
+	}
+	return list
+}
+
+// adds the pings for an alert to message, allowing exactly those so nothing
+// in the message can ping anyone else
+func addMentions(message *discordgo.MessageSend, roles []string, users []string) {
+	message.AllowedMentions = &discordgo.MessageAllowedMentions{
+		Parse: []discordgo.AllowedMentionType{},
+		Roles: roles,
+		Users: users,
+	}
+	for _, RID := range roles {
+		message.Content += "<@&" + RID + "> "
+	}
+	for _, UID := range users {
+		message.Content += "<@" + UID + "> "
+	}
+}
+
+// adds or removes a role or user in a set of mentions
+func (mentions MentionSettings) set(RID string, UID string, remove bool) MentionSettings {
+	if RID != "" {
+		mentions.Roles, _ = removeID(mentions.Roles, RID)
+		if !remove {
+			mentions.Roles = append(mentions.Roles, RID)
+		}
+	}
+	if UID != "" {
+		mentions.Users, _ = removeID(mentions.Users, UID)
+		if !remove {
+			mentions.Users = append(mentions.Users, UID)
+		}
+	}
+	return mentions
+}
+
+// whether a set of mentions holds nothing worth keeping
+func (mentions MentionSettings) empty() bool {
+	return len(mentions.Roles) == 0 && len(mentions.Users) == 0 && !mentions.Recovery
+}
+
+// stores a bot's mentions, dropping them once there's nothing left
+func setBotMentions(botMentions map[string]MentionSettings, BID string, mentions MentionSettings) map[string]MentionSettings {
+	if mentions.empty() {
+		delete(botMentions, BID)
+		return botMentions
+	}
+	if botMentions == nil {
+		botMentions = make(map[string]MentionSettings)
+	}
+	botMentions[BID] = mentions
+	return botMentions
+}
+
+// describes a set of mentions for /mention list
+func mentionList(mentions MentionSettings) string {
+	var pings []string
+	for _, RID := range mentions.Roles {
+		pings = append(pings, "<@&"+RID+">")
+	}
+	for _, UID := range mentions.Users {
+		pings = append(pings, "<@"+UID+">")
+	}
+	if len(pings) == 0 {
+		return "nobody"
+	}
+	list := strings.Join(pings, " ")
+	if mentions.Recovery {
+		list += " (also on recovery)"
+	}
+	return list
+}
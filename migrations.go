@@ -0,0 +1,169 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/pkg/errors"
+)
+
+// ----- MIGRATIONS
+
+// migration upgrades persisted state to version. Each backend gets its own
+// step since the json document and the sqlite tables change differently.
+type migration struct {
+	version     int
+	description string
+	json        func(doc map[string]interface{}) error
+	sqlite      func(tx *sql.Tx) error
+}
+
+// every migration in order, append new ones to the end and never edit old ones
+var migrations = []migration{
+	{
+		version:     1,
+		description: "stamp schema version and fill in missing ids and lists",
+		json: func(doc map[string]interface{}) error {
+			lists := map[string][]string{
+				"bots":        {"guilds", "subscribers"},
+				"guilds":      {"bots"},
+				"subscribers": {"bots"},
+			}
+			for table, fields := range lists {
+				if doc[table] == nil {
+					doc[table] = map[string]interface{}{}
+				}
+				entries, ok := doc[table].(map[string]interface{})
+				if !ok {
+					return errors.New(table + " is not an object")
+				}
+				for ID, entry := range entries {
+					record, ok := entry.(map[string]interface{})
+					if !ok {
+						return errors.New(table + "." + ID + " is not an object")
+					}
+					record["id"] = ID
+					for _, field := range fields {
+						if record[field] == nil {
+							record[field] = []interface{}{}
+						}
+					}
+				}
+			}
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			// the tables created by sqliteSchema are version 1
+			return nil
+		},
+	},
+	{
+		version:     2,
+		description: "add per guild settings",
+		json: func(doc map[string]interface{}) error {
+			// a missing settings object decodes to the defaults
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec("ALTER TABLE guilds ADD COLUMN settings TEXT NOT NULL DEFAULT '{}'")
+			return err
+		},
+	},
+	{
+		version:     3,
+		description: "add per subscriber settings",
+		json: func(doc map[string]interface{}) error {
+			// a missing settings object decodes to the defaults
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec("ALTER TABLE subscribers ADD COLUMN settings TEXT NOT NULL DEFAULT '{}'")
+			return err
+		},
+	},
+	{
+		version:     4,
+		description: "add status history",
+		json: func(doc map[string]interface{}) error {
+			// json stores keep history in a file of its own
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`CREATE TABLE status_events (
+	id       INTEGER PRIMARY KEY,
+	bot_id   TEXT NOT NULL,
+	previous TEXT NOT NULL,
+	status   TEXT NOT NULL,
+	time     INTEGER NOT NULL,
+	guilds   TEXT NOT NULL DEFAULT '[]'
+);
+CREATE INDEX status_events_bot_time ON status_events (bot_id, time)`)
+			return err
+		},
+	},
+	{
+		version:     5,
+		description: "add dead letters",
+		json: func(doc map[string]interface{}) error {
+			// json stores keep dead letters in a file of their own
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`CREATE TABLE dead_letters (
+	id            INTEGER PRIMARY KEY,
+	time          INTEGER NOT NULL,
+	guild_id      TEXT NOT NULL DEFAULT '',
+	subscriber_id TEXT NOT NULL DEFAULT '',
+	channel       TEXT NOT NULL,
+	alert         TEXT NOT NULL,
+	error         TEXT NOT NULL,
+	attempts      INTEGER NOT NULL
+)`)
+			return err
+		},
+	},
+}
+
+// the schema version this build reads and writes
+func schemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// Migrator is implemented by stores that keep a schema version
+type Migrator interface {
+	SchemaVersion() (int, error)
+	// applies the migrations in order, recording each version as it goes
+	Migrate(pending []migration) error
+}
+
+// brings a store up to the current schema version
+func migrateStore(st Store) (from int, to int, err error) {
+	migrator, ok := st.(Migrator)
+	if !ok {
+		err = errors.New("store doesn't support migrations")
+		return
+	}
+	from, err = migrator.SchemaVersion()
+	if err != nil {
+		return
+	}
+	to = schemaVersion()
+	if from > to {
+		err = errors.New(fmt.Sprint("store is at schema version ", from, " but this build only knows up to ", to))
+		return
+	}
+
+	var pending []migration
+	for _, m := range migrations {
+		if m.version > from {
+			log.Println("[MIGRATE] migrating to version", m.version, "|", m.description)
+			pending = append(pending, m)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	err = migrator.Migrate(pending)
+	return
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ----- NOTIFIERS
+
+// Notifier delivers alerts to one place
+type Notifier interface {
+	// a failed attempt worth making again is a *retryableError
+	Notify(alert Alert) error
+	// "discord", "webhook" or "email"
+	Kind() string
+	// where alerts go, for logs
+	String() string
+}
+
+// the notifiers of a destination, none if it stopped watching the bot
+func destNotifiers(s *discordgo.Session, dest destination, BID string) (notifiers []Notifier) {
+	if dest.GID != "" {
+		guild, err := store.GetGuild(dest.GID)
+		if err != nil {
+			log.Println("[NOTIFIERS] error getting notify guild |", err)
+			return
+		}
+		if _, err = indexID(guild.Bots, BID); err != nil {
+			return
+		}
+		notifiers = append(notifiers, &discordNotifier{s: s, CID: routeChannel(s, guild, BID), guild: &guild})
+		if guild.Settings.Webhook.URL != "" {
+			notifiers = append(notifiers, &webhookNotifier{GID: guild.ID, settings: guild.Settings.Webhook})
+		}
+		return
+	}
+	subscriber, err := store.GetSubscriber(dest.SID)
+	if err != nil {
+		return
+	}
+	if _, err = indexID(subscriber.Bots, BID); err != nil {
+		return
+	}
+	userDM, err := s.UserChannelCreate(dest.SID)
+	if err != nil {
+		log.Println("[NOTIFIERS] error creating DM channel |", err)
+	} else {
+		notifiers = append(notifiers, &discordNotifier{s: s, CID: userDM.ID})
+	}
+	if _, enabled := loadSmtpConfig(); enabled && subscriber.Settings.Email.Verified {
+		notifiers = append(notifiers, &emailNotifier{address: subscriber.Settings.Email.Address})
+	}
+	return
+}
+
+// discordNotifier sends alerts to a channel, with a guild's template and
+// mentions when it's a guild's channel
+type discordNotifier struct {
+	s     *discordgo.Session
+	CID   string
+	guild *Guild
+}
+
+func (dn *discordNotifier) Notify(alert Alert) error {
+	message := &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{alertEmbed(alert)}}
+	if dn.guild != nil {
+		message.Embeds[0] = guildAlertEmbed(dn.s, *dn.guild, alert)
+		if roles, users := alertMentions(*dn.guild, alert); len(roles)+len(users) > 0 {
+			addMentions(message, roles, users)
+		}
+	}
+	// retries are left to the delivery
+	_, err := dn.s.ChannelMessageSendComplex(dn.CID, message, discordgo.WithRetryOnRatelimit(false), discordgo.WithRestRetries(0))
+	return classifyDiscordError(err)
+}
+
+func (dn *discordNotifier) Kind() string {
+	return "discord"
+}
+
+func (dn *discordNotifier) String() string {
+	return "channel " + dn.CID
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ----- PAGES
+
+// bots shown on each page of a bot list
+const botsPerPage = 9
+
+// a page button's custom ID is "page:<button>:<page>:<list>:<key>", where the
+// list is "server" (key is the guild ID), "subscriptions" (the subscriber ID)
+// or "outages" (the bot ID and the unix start time, split by a dash). The
+// button name keeps IDs unique when two buttons go to the same page.
+
+// makes the first, previous, next and last buttons for a list, none if it
+// fits on one page
+func pageButtons(list string, key string, page int, maxPage int) []discordgo.MessageComponent {
+	if maxPage <= 1 {
+		return []discordgo.MessageComponent{}
+	}
+	button := func(name string, emoji string, target int, disabled bool) discordgo.Button {
+		return discordgo.Button{
+			Emoji:    discordgo.ComponentEmoji{Name: emoji},
+			Style:    discordgo.SecondaryButton,
+			CustomID: strings.Join([]string{"page", name, strconv.Itoa(target), list, key}, ":"),
+			Disabled: disabled,
+		}
+	}
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				button("first", "⏮️", 1, page <= 1),
+				button("prev", "⬅️", page-1, page <= 1),
+				button("next", "➡️", page+1, page >= maxPage),
+				button("last", "⏭️", maxPage, page >= maxPage),
+			},
+		},
+	}
+}
+
+// keeps a page in range after a list has shrunk or grown
+func clampPage(page int, maxPage int) int {
+	if page > maxPage {
+		return maxPage
+	}
+	if page < 1 {
+		return 1
+	}
+	return page
+}
+
+// handles button presses, the only components are page buttons. Every press
+// is answered so discord never shows it as failed.
+func componentHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+	parts := strings.SplitN(i.MessageComponentData().CustomID, ":", 5)
+	if len(parts) != 5 || parts[0] != "page" || i.Message == nil || len(i.Message.Embeds) == 0 {
+		respondPageGone(s, i, "This list can't be paged, run the command again")
+		return
+	}
+	page, err := strconv.Atoi(parts[2])
+	if err != nil {
+		respondPageGone(s, i, "This list can't be paged, run the command again")
+		return
+	}
+	list, key := parts[3], parts[4]
+
+	// the title, description and chart stay, only the page changes
+	embed := i.Message.Embeds[0]
+	embed.Fields = []*discordgo.MessageEmbedField{}
+	embed.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	var components []discordgo.MessageComponent
+	switch list {
+	case "server", "subscriptions":
+		var bots []string
+		if list == "server" {
+			guild, err := store.GetGuild(key)
+			if err != nil {
+				respondPageGone(s, i, "Bots aren't being watched in this server anymore")
+				return
+			}
+			bots = guild.Bots
+		} else {
+			user := i.User
+			if user == nil {
+				user = i.Member.User
+			}
+			if user.ID != key {
+				respondPageGone(s, i, "Only <@"+key+"> can turn these pages, use /list subscriptions for yours")
+				return
+			}
+			subscriber, err := store.GetSubscriber(key)
+			if err != nil || len(subscriber.Bots) == 0 {
+				respondPageGone(s, i, "You're not subscribed to any bots anymore")
+				return
+			}
+			bots = subscriber.Bots
+		}
+		maxPage := pageCount(len(bots), botsPerPage)
+		page = clampPage(page, maxPage)
+		err = makeBotList(s, embed, bots, page)
+		if err != nil {
+			logMessage(s, "[PAGES] error making list |", err)
+			respondPageGone(s, i, "Couldn't load this page, try again later")
+			return
+		}
+		components = pageButtons(list, key, page, maxPage)
+	case "outages":
+		BID, sinceText, _ := strings.Cut(key, "-")
+		sinceUnix, err := strconv.ParseInt(sinceText, 10, 64)
+		if err != nil {
+			respondPageGone(s, i, "This list can't be paged, run the command again")
+			return
+		}
+		bot, err := store.GetBot(BID)
+		if err != nil || !visibleBot(i, bot) {
+			respondPageGone(s, i, notVisible(i, BID)+" anymore")
+			return
+		}
+		events, err := history.Events(BID, time.Unix(0, 0))
+		if err != nil {
+			logMessage(s, "[PAGES] error getting history |", err)
+			respondPageGone(s, i, "Couldn't load this page, try again later")
+			return
+		}
+		spans := outages(bot, events, time.Unix(sinceUnix, 0), time.Now())
+		maxPage := pageCount(len(spans), outagesPerPage)
+		page = clampPage(page, maxPage)
+		makeOutageList(embed, spans, page)
+		components = pageButtons(list, key, page, maxPage)
+	default:
+		respondPageGone(s, i, "This list can't be paged, run the command again")
+		return
+	}
+
+	data := &discordgo.InteractionResponseData{
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: components,
+	}
+	response := &discordgo.InteractionResponse{Type: discordgo.InteractionResponseUpdateMessage, Data: data}
+	err = s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		logMessage(s, "[PAGES] error updating message |", err)
+	}
+}
+
+// tells whoever pressed a button that the page can't be turned, the list
+// itself is left as it is
+func respondPageGone(s *discordgo.Session, i *discordgo.InteractionCreate, description string) {
+	embeds := []*discordgo.MessageEmbed{
+		{
+			Title:       "Couldn't turn the page",
+			Description: description,
+			Color:       failColor,
+		},
+	}
+	responseData := &discordgo.InteractionResponseData{Embeds: embeds, Flags: discordgo.MessageFlagsEphemeral}
+	response := &discordgo.InteractionResponse{Type: 4, Data: responseData}
+	go s.InteractionRespond(i.Interaction, response)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// ----- ROUTES
+
+// the channel alerts about a bot go to in a guild: the bot's own channel,
+// then the channel of its first routed role, then the guild's channel
+func routeChannel(s *discordgo.Session, guild Guild, BID string) string {
+	if CID, exists := guild.Settings.BotChannels[BID]; exists {
+		return CID
+	}
+	if len(guild.Settings.RoleChannels) == 0 {
+		return guild.CID
+	}
+	member, err := guildMember(s, guild.ID, BID)
+	if err != nil {
+		return guild.CID
+	}
+	for _, route := range guild.Settings.RoleChannels {
+		if _, err = indexID(member.Roles, route.RID); err == nil {
+			return route.CID
+		}
+	}
+	return guild.CID
+}
+
+// sets or, with an empty CID, removes the channel for a role
+func setRoleChannel(routes []RoleChannel, RID string, CID string) []RoleChannel {
+	for n, route := range routes {
+		if route.RID != RID {
+			continue
+		}
+		if CID == "" {
+			return append(routes[:n], routes[n+1:]...)
+		}
+		routes[n].CID = CID
+		return routes
+	}
+	if CID == "" {
+		return routes
+	}
+	return append(routes, RoleChannel{RID: RID, CID: CID})
+}
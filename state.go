@@ -0,0 +1,383 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// ----- STATE CACHE
+
+// cachedStore holds every bot, guild and subscriber in memory. It's loaded
+// once at startup, serves every lookup from memory and writes changes back
+// to the underlying store in batches.
+type cachedStore struct {
+	backing Store
+
+	mu          sync.RWMutex
+	bots        map[string]Bot
+	guilds      map[string]Guild
+	subscribers map[string]Subscriber
+	dirty       Batch
+
+	// serializes flushes so batches reach the backing store in order
+	flushMu sync.Mutex
+	done    chan struct{}
+	stopped chan struct{}
+
+	// held by Update so a flush never takes half of an update's changes
+	updateMu sync.Mutex
+	// mark of the last finished Update and of the last flushed one
+	mark        uint64
+	flushedMark uint64
+	// called once every change up to a mark has reached the backing store
+	onFlush func(mark uint64)
+}
+
+// loads everything from backing and starts flushing changes every interval.
+// onFlush may be nil.
+func newCachedStore(backing Store, interval time.Duration, onFlush func(mark uint64)) (*cachedStore, error) {
+	bots, err := backing.ListBots()
+	if err != nil {
+		return nil, err
+	}
+	guilds, err := backing.ListGuilds()
+	if err != nil {
+		return nil, err
+	}
+	subscribers, err := backing.ListSubscribers()
+	if err != nil {
+		return nil, err
+	}
+	cs := &cachedStore{
+		backing:     backing,
+		bots:        bots,
+		guilds:      guilds,
+		subscribers: subscribers,
+		dirty:       newBatch(),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		onFlush:     onFlush,
+	}
+	go cs.run(interval)
+	return cs, nil
+}
+
+// how often the cache is flushed, FLUSH_INTERVAL or 5s
+func flushInterval() time.Duration {
+	return envDuration("FLUSH_INTERVAL", 5*time.Second)
+}
+
+// flushes pending changes every interval until closed
+func (cs *cachedStore) run(interval time.Duration) {
+	defer close(cs.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := cs.Flush()
+			if err != nil {
+				log.Println("[STATE CACHE] error flushing |", err)
+			}
+		case <-cs.done:
+			return
+		}
+	}
+}
+
+// writes pending changes to the backing store. Changes that fail to write
+// are kept for the next flush unless they were replaced in the meantime.
+func (cs *cachedStore) Flush() error {
+	cs.flushMu.Lock()
+	defer cs.flushMu.Unlock()
+
+	cs.updateMu.Lock()
+	cs.mu.Lock()
+	batch := cs.dirty
+	cs.dirty = newBatch()
+	mark := cs.mark
+	cs.mu.Unlock()
+	cs.updateMu.Unlock()
+
+	var err error
+	if batch.Len() > 0 {
+		err = cs.backing.Apply(batch)
+	}
+	if err == nil {
+		if mark > cs.flushedMark && cs.onFlush != nil {
+			cs.onFlush(mark)
+		}
+		cs.flushedMark = mark
+	} else {
+		cs.mu.Lock()
+		for BID, bot := range batch.Bots {
+			if _, exists := cs.dirty.Bots[BID]; !exists {
+				cs.dirty.Bots[BID] = bot
+			}
+		}
+		for GID, guild := range batch.Guilds {
+			if _, exists := cs.dirty.Guilds[GID]; !exists {
+				cs.dirty.Guilds[GID] = guild
+			}
+		}
+		for SID, subscriber := range batch.Subscribers {
+			if _, exists := cs.dirty.Subscribers[SID]; !exists {
+				cs.dirty.Subscribers[SID] = subscriber
+			}
+		}
+		cs.mu.Unlock()
+	}
+	return err
+}
+
+// runs fn as a single change. mark is passed to onFlush once the changes
+// made by fn (and every earlier Update) are in the backing store.
+func (cs *cachedStore) Update(mark uint64, fn func() error) error {
+	cs.updateMu.Lock()
+	defer cs.updateMu.Unlock()
+	err := fn()
+	cs.mu.Lock()
+	cs.mark = mark
+	cs.mu.Unlock()
+	return err
+}
+
+// stops the flusher, writes anything pending and closes the backing store
+func (cs *cachedStore) Close() error {
+	close(cs.done)
+	<-cs.stopped
+	err := cs.Flush()
+	if err != nil {
+		log.Println("[STATE CACHE] error flushing on close |", err)
+	}
+	closeErr := cs.backing.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ----- COPIES
+
+func copyIDs(IDs []string) []string {
+	return append([]string{}, IDs...)
+}
+
+func (bot Bot) copy() Bot {
+	bot.Guilds = copyIDs(bot.Guilds)
+	bot.Subscribers = copyIDs(bot.Subscribers)
+	return bot
+}
+
+func (guild Guild) copy() Guild {
+	guild.Bots = copyIDs(guild.Bots)
+	guild.Settings = guild.Settings.copy()
+	return guild
+}
+
+func (settings GuildSettings) copy() GuildSettings {
+	if settings.BotGracePeriods != nil {
+		botGracePeriods := make(map[string]int64, len(settings.BotGracePeriods))
+		for BID, gracePeriod := range settings.BotGracePeriods {
+			botGracePeriods[BID] = gracePeriod
+		}
+		settings.BotGracePeriods = botGracePeriods
+	}
+	if settings.BotChannels != nil {
+		botChannels := make(map[string]string, len(settings.BotChannels))
+		for BID, CID := range settings.BotChannels {
+			botChannels[BID] = CID
+		}
+		settings.BotChannels = botChannels
+	}
+	if settings.Templates != nil {
+		templates := make(map[string]AlertTemplate, len(settings.Templates))
+		for kind, template := range settings.Templates {
+			templates[kind] = template
+		}
+		settings.Templates = templates
+	}
+	if settings.RoleChannels != nil {
+		settings.RoleChannels = append([]RoleChannel{}, settings.RoleChannels...)
+	}
+	if settings.Include != nil {
+		settings.Include = copyIDs(settings.Include)
+	}
+	if settings.Exclude != nil {
+		settings.Exclude = copyIDs(settings.Exclude)
+	}
+	settings.Mentions = settings.Mentions.copy()
+	if settings.BotMentions != nil {
+		botMentions := make(map[string]MentionSettings, len(settings.BotMentions))
+		for BID, mentions := range settings.BotMentions {
+			botMentions[BID] = mentions.copy()
+		}
+		settings.BotMentions = botMentions
+	}
+	return settings
+}
+
+func (mentions MentionSettings) copy() MentionSettings {
+	if mentions.Roles != nil {
+		mentions.Roles = copyIDs(mentions.Roles)
+	}
+	if mentions.Users != nil {
+		mentions.Users = copyIDs(mentions.Users)
+	}
+	return mentions
+}
+
+func (subscriber Subscriber) copy() Subscriber {
+	subscriber.Bots = copyIDs(subscriber.Bots)
+	return subscriber
+}
+
+// ----- STORE METHODS
+
+func (cs *cachedStore) GetBot(BID string) (Bot, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	bot, exists := cs.bots[BID]
+	if !exists {
+		return Bot{}, errBotNotFound
+	}
+	return bot.copy(), nil
+}
+
+func (cs *cachedStore) ListBots() (map[string]Bot, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	botMap := make(map[string]Bot, len(cs.bots))
+	for BID, bot := range cs.bots {
+		botMap[BID] = bot.copy()
+	}
+	return botMap, nil
+}
+
+func (cs *cachedStore) PutBot(bot Bot) error {
+	bot = bot.copy()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.bots[bot.ID] = bot
+	cs.dirty.Bots[bot.ID] = &bot
+	return nil
+}
+
+func (cs *cachedStore) DeleteBot(BID string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.bots, BID)
+	cs.dirty.Bots[BID] = nil
+	return nil
+}
+
+func (cs *cachedStore) GetGuild(GID string) (Guild, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	guild, exists := cs.guilds[GID]
+	if !exists {
+		return Guild{}, errGuildNotFound
+	}
+	return guild.copy(), nil
+}
+
+func (cs *cachedStore) ListGuilds() (map[string]Guild, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	guildMap := make(map[string]Guild, len(cs.guilds))
+	for GID, guild := range cs.guilds {
+		guildMap[GID] = guild.copy()
+	}
+	return guildMap, nil
+}
+
+func (cs *cachedStore) PutGuild(guild Guild) error {
+	guild = guild.copy()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.guilds[guild.ID] = guild
+	cs.dirty.Guilds[guild.ID] = &guild
+	return nil
+}
+
+func (cs *cachedStore) DeleteGuild(GID string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.guilds, GID)
+	cs.dirty.Guilds[GID] = nil
+	return nil
+}
+
+func (cs *cachedStore) GetSubscriber(SID string) (Subscriber, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	subscriber, exists := cs.subscribers[SID]
+	if !exists {
+		return Subscriber{}, errSubscriberNotFound
+	}
+	return subscriber.copy(), nil
+}
+
+func (cs *cachedStore) ListSubscribers() (map[string]Subscriber, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	subscriberMap := make(map[string]Subscriber, len(cs.subscribers))
+	for SID, subscriber := range cs.subscribers {
+		subscriberMap[SID] = subscriber.copy()
+	}
+	return subscriberMap, nil
+}
+
+func (cs *cachedStore) PutSubscriber(subscriber Subscriber) error {
+	subscriber = subscriber.copy()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.subscribers[subscriber.ID] = subscriber
+	cs.dirty.Subscribers[subscriber.ID] = &subscriber
+	return nil
+}
+
+func (cs *cachedStore) DeleteSubscriber(SID string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.subscribers, SID)
+	cs.dirty.Subscribers[SID] = nil
+	return nil
+}
+
+func (cs *cachedStore) Apply(batch Batch) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for BID, bot := range batch.Bots {
+		if bot == nil {
+			delete(cs.bots, BID)
+			cs.dirty.Bots[BID] = nil
+		} else {
+			copied := bot.copy()
+			cs.bots[BID] = copied
+			cs.dirty.Bots[BID] = &copied
+		}
+	}
+	for GID, guild := range batch.Guilds {
+		if guild == nil {
+			delete(cs.guilds, GID)
+			cs.dirty.Guilds[GID] = nil
+		} else {
+			copied := guild.copy()
+			cs.guilds[GID] = copied
+			cs.dirty.Guilds[GID] = &copied
+		}
+	}
+	for SID, subscriber := range batch.Subscribers {
+		if subscriber == nil {
+			delete(cs.subscribers, SID)
+			cs.dirty.Subscribers[SID] = nil
+		} else {
+			copied := subscriber.copy()
+			cs.subscribers[SID] = copied
+			cs.dirty.Subscribers[SID] = &copied
+		}
+	}
+	return nil
+}
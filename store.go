@@ -0,0 +1,527 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ----- STORE
+
+// Store persists bots, guilds and subscribers. Every backend returns copies,
+// so callers are free to modify what they get back before putting it again.
+type Store interface {
+	GetBot(BID string) (Bot, error)
+	ListBots() (map[string]Bot, error)
+	PutBot(bot Bot) error
+	DeleteBot(BID string) error
+
+	GetGuild(GID string) (Guild, error)
+	ListGuilds() (map[string]Guild, error)
+	PutGuild(guild Guild) error
+	DeleteGuild(GID string) error
+
+	GetSubscriber(SID string) (Subscriber, error)
+	ListSubscribers() (map[string]Subscriber, error)
+	PutSubscriber(subscriber Subscriber) error
+	DeleteSubscriber(SID string) error
+
+	Apply(batch Batch) error
+	Close() error
+}
+
+// Batch is a set of changes written in one go. A nil entry deletes the ID.
+type Batch struct {
+	Bots        map[string]*Bot
+	Guilds      map[string]*Guild
+	Subscribers map[string]*Subscriber
+}
+
+// creates an empty batch
+func newBatch() Batch {
+	return Batch{
+		Bots:        make(map[string]*Bot),
+		Guilds:      make(map[string]*Guild),
+		Subscribers: make(map[string]*Subscriber),
+	}
+}
+
+// number of changes in the batch
+func (b Batch) Len() int {
+	return len(b.Bots) + len(b.Guilds) + len(b.Subscribers)
+}
+
+var (
+	errBotNotFound        = errors.New("bot not found")
+	errGuildNotFound      = errors.New("guild not found")
+	errSubscriberNotFound = errors.New("subscriber not found")
+)
+
+// opens the backend chosen by STORE_BACKEND ("json" by default, or "sqlite")
+func openStore() (Store, error) {
+	switch os.Getenv("STORE_BACKEND") {
+	case "", "json":
+		js := newJsonStore("data.json", jsonSnapshots())
+		err := js.recover()
+		if err != nil {
+			return nil, err
+		}
+		return js, nil
+	case "sqlite":
+		return newSqliteStore(sqlitePath())
+	}
+	return nil, errors.New("unknown store backend " + os.Getenv("STORE_BACKEND"))
+}
+
+// number of previous data.json snapshots kept, JSON_SNAPSHOTS or 5
+func jsonSnapshots() int {
+	return envInt("JSON_SNAPSHOTS", 5)
+}
+
+// path of the sqlite database, SQLITE_PATH or OfflineNotifier.db
+func sqlitePath() string {
+	path := os.Getenv("SQLITE_PATH")
+	if path == "" {
+		path = "OfflineNotifier.db"
+	}
+	return path
+}
+
+// ----- JSON STORE
+
+// jsonDocument is the on-disk layout of data.json
+type jsonDocument struct {
+	Version     int                   `json:"version"`
+	Bots        map[string]Bot        `json:"bots"`
+	Guilds      map[string]Guild      `json:"guilds"`
+	Subscribers map[string]Subscriber `json:"subscribers"`
+}
+
+// jsonStore keeps everything in a single json file. Writes go to a temp
+// file that is synced and renamed over the live one, and the previous
+// versions are kept as path.1 (newest) to path.N (oldest).
+type jsonStore struct {
+	path      string
+	snapshots int
+	mu        sync.Mutex
+}
+
+// creates a store backed by the json file at path
+func newJsonStore(path string, snapshots int) *jsonStore {
+	return &jsonStore{path: path, snapshots: snapshots}
+}
+
+// path of the nth snapshot
+func (js *jsonStore) snapshotPath(n int) string {
+	return js.path + "." + strconv.Itoa(n)
+}
+
+// reads and parses the whole json file
+func (js *jsonStore) read() (jsonDocument, error) {
+	return readJsonDocument(js.path)
+}
+
+// reads and parses a json document
+func readJsonDocument(path string) (doc jsonDocument, err error) {
+	jsonData, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	return parseJsonDocument(jsonData, path)
+}
+
+// reads a json document and migrates it to the current schema version in
+// memory, the file itself is left as it is
+func readMigratedJsonDocument(path string) (doc jsonDocument, err error) {
+	jsonData, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var raw map[string]interface{}
+	err = json.Unmarshal(jsonData, &raw)
+	if err != nil {
+		err = errors.Wrap(err, "parsing "+path)
+		return
+	}
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+	from, _ := raw["version"].(float64)
+	if int(from) > schemaVersion() {
+		err = errors.New(fmt.Sprint(path, " is at schema version ", int(from), " but this build only knows up to ", schemaVersion()))
+		return
+	}
+	for _, m := range migrations {
+		if m.version > int(from) {
+			err = migrateJsonDocument(raw, m)
+			if err != nil {
+				return
+			}
+		}
+	}
+	jsonData, err = json.Marshal(raw)
+	if err != nil {
+		return
+	}
+	return parseJsonDocument(jsonData, path)
+}
+
+// parses a json document, filling in missing tables
+func parseJsonDocument(jsonData []byte, path string) (doc jsonDocument, err error) {
+	err = json.Unmarshal(jsonData, &doc)
+	if err != nil {
+		err = errors.Wrap(err, "parsing "+path)
+		return
+	}
+	if doc.Bots == nil {
+		doc.Bots = make(map[string]Bot)
+	}
+	if doc.Guilds == nil {
+		doc.Guilds = make(map[string]Guild)
+	}
+	if doc.Subscribers == nil {
+		doc.Subscribers = make(map[string]Subscriber)
+	}
+	return
+}
+
+// writes the whole json file
+func (js *jsonStore) write(doc jsonDocument) error {
+	jsonData, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return js.writeAtomic(jsonData)
+}
+
+// writes data to a synced temp file, rotates the snapshots and renames the
+// temp file over the live one so a crash never leaves a half written file
+func (js *jsonStore) writeAtomic(data []byte) error {
+	tmp, err := writeTempFile(js.path, data)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	err = js.rotate()
+	if err != nil {
+		return errors.Wrap(err, "rotating snapshots")
+	}
+	err = os.Rename(tmp, js.path)
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(js.path))
+}
+
+// writes and syncs data to a new temp file next to path, ready to be
+// renamed over it
+func writeTempFile(path string, data []byte) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", errors.Wrap(err, "writing temp file")
+	}
+	return tmp.Name(), nil
+}
+
+// shifts path.1..path.N-1 up by one and keeps the live file as path.1
+func (js *jsonStore) rotate() error {
+	if js.snapshots == 0 {
+		return nil
+	}
+	if _, err := os.Stat(js.path); os.IsNotExist(err) {
+		return nil
+	}
+	err := os.Remove(js.snapshotPath(js.snapshots))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := js.snapshots - 1; n >= 1; n-- {
+		err = os.Rename(js.snapshotPath(n), js.snapshotPath(n+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	// a hard link keeps the live file in place until the rename replaces it
+	err = os.Link(js.path, js.snapshotPath(1))
+	if err != nil {
+		err = copyFile(js.path, js.snapshotPath(1))
+	}
+	return err
+}
+
+// makes a finished rename durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// copies a file, used when hard links aren't supported
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (js *jsonStore) SchemaVersion() (int, error) {
+	doc, err := js.view()
+	return doc.Version, err
+}
+
+// migrates the raw document in memory and writes it back once, so a failed
+// migration leaves the file untouched
+func (js *jsonStore) Migrate(pending []migration) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	jsonData, err := os.ReadFile(js.path)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	err = json.Unmarshal(jsonData, &doc)
+	if err != nil {
+		return errors.Wrap(err, "parsing "+js.path)
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	for _, m := range pending {
+		err = migrateJsonDocument(doc, m)
+		if err != nil {
+			return err
+		}
+	}
+	jsonData, err = json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return js.writeAtomic(jsonData)
+}
+
+// applies one migration to a raw document and stamps its version
+func migrateJsonDocument(doc map[string]interface{}, m migration) error {
+	err := m.json(doc)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprint("migrating to version ", m.version))
+	}
+	doc["version"] = m.version
+	return nil
+}
+
+// checks the live file at startup and, if it can't be read, restores the
+// newest snapshot that can
+func (js *jsonStore) recover() error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	_, readErr := js.read()
+	if readErr == nil {
+		return nil
+	}
+	for n := 1; n <= js.snapshots; n++ {
+		data, err := os.ReadFile(js.snapshotPath(n))
+		if err != nil {
+			continue
+		}
+		_, err = readJsonDocument(js.snapshotPath(n))
+		if err != nil {
+			log.Println("[JSON STORE] skipping invalid snapshot |", err)
+			continue
+		}
+		// keep the broken file around for inspection
+		os.Rename(js.path, js.path+".corrupt")
+		err = js.writeAtomic(data)
+		if err != nil {
+			return errors.Wrap(err, "restoring "+js.snapshotPath(n))
+		}
+		message := fmt.Sprint("[JSON STORE] ", js.path, " is unreadable (", readErr, "), restored ", js.snapshotPath(n))
+		log.Println(message)
+		fmt.Println(message)
+		return nil
+	}
+	return errors.Wrap(readErr, "no valid snapshot to restore")
+}
+
+// reads the json file, lets fn modify it and writes it back
+func (js *jsonStore) update(fn func(doc *jsonDocument) error) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	doc, err := js.read()
+	if err != nil {
+		return err
+	}
+	err = fn(&doc)
+	if err != nil {
+		return err
+	}
+	return js.write(doc)
+}
+
+// reads the json file for a lookup
+func (js *jsonStore) view() (jsonDocument, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	return js.read()
+}
+
+func (js *jsonStore) Close() error {
+	return nil
+}
+
+func (js *jsonStore) Apply(batch Batch) error {
+	return js.update(func(doc *jsonDocument) error {
+		for BID, bot := range batch.Bots {
+			if bot == nil {
+				delete(doc.Bots, BID)
+			} else {
+				doc.Bots[BID] = *bot
+			}
+		}
+		for GID, guild := range batch.Guilds {
+			if guild == nil {
+				delete(doc.Guilds, GID)
+			} else {
+				doc.Guilds[GID] = *guild
+			}
+		}
+		for SID, subscriber := range batch.Subscribers {
+			if subscriber == nil {
+				delete(doc.Subscribers, SID)
+			} else {
+				doc.Subscribers[SID] = *subscriber
+			}
+		}
+		return nil
+	})
+}
+
+func (js *jsonStore) GetBot(BID string) (bot Bot, err error) {
+	doc, err := js.view()
+	if err != nil {
+		return
+	}
+	bot, exists := doc.Bots[BID]
+	if !exists {
+		err = errBotNotFound
+	}
+	return
+}
+
+func (js *jsonStore) ListBots() (map[string]Bot, error) {
+	doc, err := js.view()
+	return doc.Bots, err
+}
+
+func (js *jsonStore) PutBot(bot Bot) error {
+	return js.update(func(doc *jsonDocument) error {
+		doc.Bots[bot.ID] = bot
+		return nil
+	})
+}
+
+func (js *jsonStore) DeleteBot(BID string) error {
+	return js.update(func(doc *jsonDocument) error {
+		delete(doc.Bots, BID)
+		return nil
+	})
+}
+
+func (js *jsonStore) GetGuild(GID string) (guild Guild, err error) {
+	doc, err := js.view()
+	if err != nil {
+		return
+	}
+	guild, exists := doc.Guilds[GID]
+	if !exists {
+		err = errGuildNotFound
+	}
+	return
+}
+
+func (js *jsonStore) ListGuilds() (map[string]Guild, error) {
+	doc, err := js.view()
+	return doc.Guilds, err
+}
+
+func (js *jsonStore) PutGuild(guild Guild) error {
+	return js.update(func(doc *jsonDocument) error {
+		doc.Guilds[guild.ID] = guild
+		return nil
+	})
+}
+
+func (js *jsonStore) DeleteGuild(GID string) error {
+	return js.update(func(doc *jsonDocument) error {
+		delete(doc.Guilds, GID)
+		return nil
+	})
+}
+
+func (js *jsonStore) GetSubscriber(SID string) (subscriber Subscriber, err error) {
+	doc, err := js.view()
+	if err != nil {
+		return
+	}
+	subscriber, exists := doc.Subscribers[SID]
+	if !exists {
+		err = errSubscriberNotFound
+	}
+	return
+}
+
+func (js *jsonStore) ListSubscribers() (map[string]Subscriber, error) {
+	doc, err := js.view()
+	return doc.Subscribers, err
+}
+
+func (js *jsonStore) PutSubscriber(subscriber Subscriber) error {
+	return js.update(func(doc *jsonDocument) error {
+		doc.Subscribers[subscriber.ID] = subscriber
+		return nil
+	})
+}
+
+func (js *jsonStore) DeleteSubscriber(SID string) error {
+	return js.update(func(doc *jsonDocument) error {
+		delete(doc.Subscribers, SID)
+		return nil
+	})
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite"
+)
+
+// ----- SQLITE STORE
+
+// version 1 of the schema, later changes belong in migrations
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS bots (
+	id        TEXT PRIMARY KEY,
+	status    TEXT NOT NULL,
+	timestamp INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS guilds (
+	id  TEXT PRIMARY KEY,
+	cid TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS subscribers (
+	id TEXT PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS guild_bots (
+	guild_id TEXT NOT NULL REFERENCES guilds(id) ON DELETE CASCADE,
+	bot_id   TEXT NOT NULL REFERENCES bots(id) ON DELETE CASCADE,
+	PRIMARY KEY (guild_id, bot_id)
+);
+CREATE INDEX IF NOT EXISTS guild_bots_bot ON guild_bots(bot_id);
+CREATE TABLE IF NOT EXISTS subscriber_bots (
+	subscriber_id TEXT NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE,
+	bot_id        TEXT NOT NULL REFERENCES bots(id) ON DELETE CASCADE,
+	PRIMARY KEY (subscriber_id, bot_id)
+);
+CREATE INDEX IF NOT EXISTS subscriber_bots_bot ON subscriber_bots(bot_id);
+`
+
+// sqliteStore keeps bots, guilds and subscribers in normalized tables, with
+// guild<->bot and subscriber<->bot relations held in join tables
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// opens (and creates if needed) the sqlite database at path
+func newSqliteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// a single connection keeps the pragmas and serializes writers
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(sqliteSchema)
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "creating schema")
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+// runs fn inside a transaction, rolling back if it fails
+func (ss *sqliteStore) transaction(fn func(tx *sql.Tx) error) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// queries a single column of IDs
+func (ss *sqliteStore) queryIDs(query string, args ...interface{}) (IDs []string, err error) {
+	rows, err := ss.db.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	IDs = []string{}
+	for rows.Next() {
+		var ID string
+		err = rows.Scan(&ID)
+		if err != nil {
+			return
+		}
+		IDs = append(IDs, ID)
+	}
+	err = rows.Err()
+	return
+}
+
+// queries pairs of IDs and groups the second column by the first
+func (ss *sqliteStore) queryLinks(query string) (links map[string][]string, err error) {
+	rows, err := ss.db.Query(query)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	links = make(map[string][]string)
+	for rows.Next() {
+		var key, ID string
+		err = rows.Scan(&key, &ID)
+		if err != nil {
+			return
+		}
+		links[key] = append(links[key], ID)
+	}
+	err = rows.Err()
+	return
+}
+
+// replaces every link of one side of a join table
+func replaceLinks(tx *sql.Tx, table string, column string, otherColumn string, ID string, others []string) error {
+	_, err := tx.Exec("DELETE FROM "+table+" WHERE "+column+" = ?", ID)
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		_, err = tx.Exec("INSERT OR IGNORE INTO "+table+" ("+column+", "+otherColumn+") VALUES (?, ?)", ID, other)
+		if err != nil {
+			return errors.Wrap(err, "linking "+ID+" to "+other)
+		}
+	}
+	return nil
+}
+
+// returns an empty list instead of nil so results match the json store
+func nonNil(IDs []string) []string {
+	if IDs == nil {
+		return []string{}
+	}
+	return IDs
+}
+
+func (ss *sqliteStore) GetBot(BID string) (bot Bot, err error) {
+	bot.ID = BID
+	err = ss.db.QueryRow("SELECT status, timestamp FROM bots WHERE id = ?", BID).Scan(&bot.Status, &bot.Timestamp)
+	if err == sql.ErrNoRows {
+		err = errBotNotFound
+	}
+	if err != nil {
+		return
+	}
+	bot.Guilds, err = ss.queryIDs("SELECT guild_id FROM guild_bots WHERE bot_id = ? ORDER BY rowid", BID)
+	if err != nil {
+		return
+	}
+	bot.Subscribers, err = ss.queryIDs("SELECT subscriber_id FROM subscriber_bots WHERE bot_id = ? ORDER BY rowid", BID)
+	return
+}
+
+func (ss *sqliteStore) ListBots() (botMap map[string]Bot, err error) {
+	guilds, err := ss.queryLinks("SELECT bot_id, guild_id FROM guild_bots ORDER BY rowid")
+	if err != nil {
+		return
+	}
+	subscribers, err := ss.queryLinks("SELECT bot_id, subscriber_id FROM subscriber_bots ORDER BY rowid")
+	if err != nil {
+		return
+	}
+
+	rows, err := ss.db.Query("SELECT id, status, timestamp FROM bots")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	botMap = make(map[string]Bot)
+	for rows.Next() {
+		var bot Bot
+		err = rows.Scan(&bot.ID, &bot.Status, &bot.Timestamp)
+		if err != nil {
+			return
+		}
+		bot.Guilds = nonNil(guilds[bot.ID])
+		bot.Subscribers = nonNil(subscribers[bot.ID])
+		botMap[bot.ID] = bot
+	}
+	err = rows.Err()
+	return
+}
+
+func (ss *sqliteStore) PutBot(bot Bot) error {
+	return ss.transaction(func(tx *sql.Tx) error {
+		return putBot(tx, bot)
+	})
+}
+
+// upserts a bot and replaces its links
+func putBot(tx *sql.Tx, bot Bot) error {
+	_, err := tx.Exec(`INSERT INTO bots (id, status, timestamp) VALUES (?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET status = excluded.status, timestamp = excluded.timestamp`,
+		bot.ID, bot.Status, bot.Timestamp)
+	if err != nil {
+		return err
+	}
+	err = replaceLinks(tx, "guild_bots", "bot_id", "guild_id", bot.ID, bot.Guilds)
+	if err != nil {
+		return err
+	}
+	return replaceLinks(tx, "subscriber_bots", "bot_id", "subscriber_id", bot.ID, bot.Subscribers)
+}
+
+func (ss *sqliteStore) DeleteBot(BID string) error {
+	_, err := ss.db.Exec("DELETE FROM bots WHERE id = ?", BID)
+	return err
+}
+
+func (ss *sqliteStore) GetGuild(GID string) (guild Guild, err error) {
+	guild.ID = GID
+	var settings string
+	err = ss.db.QueryRow("SELECT cid, settings FROM guilds WHERE id = ?", GID).Scan(&guild.CID, &settings)
+	if err == sql.ErrNoRows {
+		err = errGuildNotFound
+	}
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(settings), &guild.Settings)
+	if err != nil {
+		err = errors.Wrap(err, "parsing settings of guild "+GID)
+		return
+	}
+	guild.Bots, err = ss.queryIDs("SELECT bot_id FROM guild_bots WHERE guild_id = ? ORDER BY rowid", GID)
+	return
+}
+
+func (ss *sqliteStore) ListGuilds() (guildMap map[string]Guild, err error) {
+	bots, err := ss.queryLinks("SELECT guild_id, bot_id FROM guild_bots ORDER BY rowid")
+	if err != nil {
+		return
+	}
+
+	rows, err := ss.db.Query("SELECT id, cid, settings FROM guilds")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	guildMap = make(map[string]Guild)
+	for rows.Next() {
+		var guild Guild
+		var settings string
+		err = rows.Scan(&guild.ID, &guild.CID, &settings)
+		if err != nil {
+			return
+		}
+		err = json.Unmarshal([]byte(settings), &guild.Settings)
+		if err != nil {
+			err = errors.Wrap(err, "parsing settings of guild "+guild.ID)
+			return
+		}
+		guild.Bots = nonNil(bots[guild.ID])
+		guildMap[guild.ID] = guild
+	}
+	err = rows.Err()
+	return
+}
+
+func (ss *sqliteStore) PutGuild(guild Guild) error {
+	return ss.transaction(func(tx *sql.Tx) error {
+		return putGuild(tx, guild)
+	})
+}
+
+// upserts a guild and replaces its links
+func putGuild(tx *sql.Tx, guild Guild) error {
+	settings, err := json.Marshal(guild.Settings)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO guilds (id, cid, settings) VALUES (?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET cid = excluded.cid, settings = excluded.settings`,
+		guild.ID, guild.CID, string(settings))
+	if err != nil {
+		return err
+	}
+	return replaceLinks(tx, "guild_bots", "guild_id", "bot_id", guild.ID, guild.Bots)
+}
+
+func (ss *sqliteStore) DeleteGuild(GID string) error {
+	_, err := ss.db.Exec("DELETE FROM guilds WHERE id = ?", GID)
+	return err
+}
+
+func (ss *sqliteStore) GetSubscriber(SID string) (subscriber Subscriber, err error) {
+	subscriber.ID = SID
+	var settings string
+	err = ss.db.QueryRow("SELECT settings FROM subscribers WHERE id = ?", SID).Scan(&settings)
+	if err == sql.ErrNoRows {
+		err = errSubscriberNotFound
+	}
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(settings), &subscriber.Settings)
+	if err != nil {
+		err = errors.Wrap(err, "parsing settings of subscriber "+SID)
+		return
+	}
+	subscriber.Bots, err = ss.queryIDs("SELECT bot_id FROM subscriber_bots WHERE subscriber_id = ? ORDER BY rowid", SID)
+	return
+}
+
+func (ss *sqliteStore) ListSubscribers() (subscriberMap map[string]Subscriber, err error) {
+	bots, err := ss.queryLinks("SELECT subscriber_id, bot_id FROM subscriber_bots ORDER BY rowid")
+	if err != nil {
+		return
+	}
+
+	rows, err := ss.db.Query("SELECT id, settings FROM subscribers")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	subscriberMap = make(map[string]Subscriber)
+	for rows.Next() {
+		var subscriber Subscriber
+		var settings string
+		err = rows.Scan(&subscriber.ID, &settings)
+		if err != nil {
+			return
+		}
+		err = json.Unmarshal([]byte(settings), &subscriber.Settings)
+		if err != nil {
+			err = errors.Wrap(err, "parsing settings of subscriber "+subscriber.ID)
+			return
+		}
+		subscriber.Bots = nonNil(bots[subscriber.ID])
+		subscriberMap[subscriber.ID] = subscriber
+	}
+	err = rows.Err()
+	return
+}
+
+func (ss *sqliteStore) PutSubscriber(subscriber Subscriber) error {
+	return ss.transaction(func(tx *sql.Tx) error {
+		return putSubscriber(tx, subscriber)
+	})
+}
+
+// upserts a subscriber and replaces its links
+func putSubscriber(tx *sql.Tx, subscriber Subscriber) error {
+	settings, err := json.Marshal(subscriber.Settings)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO subscribers (id, settings) VALUES (?, ?)
+		ON CONFLICT(id) DO UPDATE SET settings = excluded.settings`,
+		subscriber.ID, string(settings))
+	if err != nil {
+		return err
+	}
+	return replaceLinks(tx, "subscriber_bots", "subscriber_id", "bot_id", subscriber.ID, subscriber.Bots)
+}
+
+func (ss *sqliteStore) DeleteSubscriber(SID string) error {
+	_, err := ss.db.Exec("DELETE FROM subscribers WHERE id = ?", SID)
+	return err
+}
+
+// writes the whole batch in one transaction. Foreign keys are only checked at
+// commit, so a new bot and the new guild listing it can arrive in any order.
+func (ss *sqliteStore) Apply(batch Batch) error {
+	return ss.transaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec("PRAGMA defer_foreign_keys = ON")
+		if err != nil {
+			return err
+		}
+		// deletes first so cascades don't remove links written below
+		for BID, bot := range batch.Bots {
+			if bot == nil {
+				if _, err = tx.Exec("DELETE FROM bots WHERE id = ?", BID); err != nil {
+					return err
+				}
+			}
+		}
+		for GID, guild := range batch.Guilds {
+			if guild == nil {
+				if _, err = tx.Exec("DELETE FROM guilds WHERE id = ?", GID); err != nil {
+					return err
+				}
+			}
+		}
+		for SID, subscriber := range batch.Subscribers {
+			if subscriber == nil {
+				if _, err = tx.Exec("DELETE FROM subscribers WHERE id = ?", SID); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, bot := range batch.Bots {
+			if bot != nil {
+				if err = putBot(tx, *bot); err != nil {
+					return err
+				}
+			}
+		}
+		for _, guild := range batch.Guilds {
+			if guild != nil {
+				if err = putGuild(tx, *guild); err != nil {
+					return err
+				}
+			}
+		}
+		for _, subscriber := range batch.Subscribers {
+			if subscriber != nil {
+				if err = putSubscriber(tx, *subscriber); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (ss *sqliteStore) SchemaVersion() (version int, err error) {
+	err = ss.db.QueryRow("PRAGMA user_version").Scan(&version)
+	return
+}
+
+// runs each migration in its own transaction along with its version bump
+func (ss *sqliteStore) Migrate(pending []migration) error {
+	for _, m := range pending {
+		err := ss.transaction(func(tx *sql.Tx) error {
+			err := m.sqlite(tx)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", m.version))
+			return err
+		})
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprint("migrating to version ", m.version))
+		}
+	}
+	return nil
+}
+
+func (ss *sqliteStore) Close() error {
+	return ss.db.Close()
+}
+
+// ----- IMPORT
+
+// errors when importing into a database that already has data
+var errImportNotEmpty = errors.New("the sqlite database already has data, import only goes into an empty one")
+
+// copies everything from a data.json file into the sqlite store, which has
+// to be at the current schema version. The file is migrated in memory and
+// never written. Links to bots, guilds or subscribers that don't exist in the
+// file are dropped. Importing into a database that isn't empty is refused so
+// nothing already there is kept or overwritten.
+func (ss *sqliteStore) importJson(path string) (counts [3]int, err error) {
+	doc, err := readMigratedJsonDocument(path)
+	if err != nil {
+		return
+	}
+	err = ss.transaction(func(tx *sql.Tx) error {
+		var exists bool
+		err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM guilds) OR EXISTS (SELECT 1 FROM bots) OR EXISTS (SELECT 1 FROM subscribers)").Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return errImportNotEmpty
+		}
+		for _, guild := range doc.Guilds {
+			settings, err := json.Marshal(guild.Settings)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("INSERT INTO guilds (id, cid, settings) VALUES (?, ?, ?)", guild.ID, guild.CID, string(settings))
+			if err != nil {
+				return errors.Wrap(err, "importing guild "+guild.ID)
+			}
+		}
+		for _, bot := range doc.Bots {
+			_, err := tx.Exec("INSERT INTO bots (id, status, timestamp) VALUES (?, ?, ?)", bot.ID, bot.Status, bot.Timestamp)
+			if err != nil {
+				return errors.Wrap(err, "importing bot "+bot.ID)
+			}
+		}
+		for _, subscriber := range doc.Subscribers {
+			settings, err := json.Marshal(subscriber.Settings)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("INSERT INTO subscribers (id, settings) VALUES (?, ?)", subscriber.ID, string(settings))
+			if err != nil {
+				return errors.Wrap(err, "importing subscriber "+subscriber.ID)
+			}
+		}
+
+		// links are taken from both sides since data.json may disagree with itself
+		for _, guild := range doc.Guilds {
+			for _, BID := range guild.Bots {
+				if _, exists := doc.Bots[BID]; exists {
+					_, err := tx.Exec("INSERT OR IGNORE INTO guild_bots (guild_id, bot_id) VALUES (?, ?)", guild.ID, BID)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		for _, bot := range doc.Bots {
+			for _, GID := range bot.Guilds {
+				if _, exists := doc.Guilds[GID]; exists {
+					_, err := tx.Exec("INSERT OR IGNORE INTO guild_bots (guild_id, bot_id) VALUES (?, ?)", GID, bot.ID)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			for _, SID := range bot.Subscribers {
+				if _, exists := doc.Subscribers[SID]; exists {
+					_, err := tx.Exec("INSERT OR IGNORE INTO subscriber_bots (subscriber_id, bot_id) VALUES (?, ?)", SID, bot.ID)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		for _, subscriber := range doc.Subscribers {
+			for _, BID := range subscriber.Bots {
+				if _, exists := doc.Bots[BID]; exists {
+					_, err := tx.Exec("INSERT OR IGNORE INTO subscriber_bots (subscriber_id, bot_id) VALUES (?, ?)", subscriber.ID, BID)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	counts = [3]int{len(doc.Bots), len(doc.Guilds), len(doc.Subscribers)}
+	return
+}
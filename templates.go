@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/pkg/errors"
+)
+
+// ----- TEMPLATES
+
+// longest each part of an embed can be
+const (
+	maxTitleLength       = 256
+	maxDescriptionLength = 4096
+	maxFooterLength      = 2048
+)
+
+// the fields a template can use
+type templateData struct {
+	Kind             string
+	Bot              string
+	BotID            string
+	Status           string
+	Previous         string
+	Activity         string
+	PreviousActivity string
+	// how long the previous status lasted, formatted like the default embeds
+	Duration string
+	Seconds  int64
+	Time     time.Time
+	// unix time of the alert, for <t:...> timestamps
+	Timestamp int64
+	Changes   int
+	Guild     string
+	GuildID   string
+}
+
+var templateFuncs = template.FuncMap{
+	"upper":  strings.ToUpper,
+	"lower":  strings.ToLower,
+	"printf": templatePrintf,
+}
+
+// the fields of an alert sent in a guild
+func alertData(alert Alert, guildName string, GID string) templateData {
+	return templateData{
+		Kind:             alert.Kind,
+		Bot:              alert.Name,
+		BotID:            alert.BID,
+		Status:           alert.Status,
+		Previous:         alert.Previous,
+		Activity:         alert.Activity,
+		PreviousActivity: alert.PreviousActivity,
+		Duration:         formatDuration(alert.Duration),
+		Seconds:          int64(alert.Duration.Seconds()),
+		Time:             alert.Time,
+		Timestamp:        alert.Time.Unix(),
+		Changes:          alert.Changes,
+		Guild:            guildName,
+		GuildID:          GID,
+	}
+}
+
+// a made up alert of a kind, for previews and validation
+func sampleAlert(kind string, BID string, name string) Alert {
+	alert := Alert{
+		Kind:     kind,
+		BID:      BID,
+		Name:     name,
+		Status:   "offline",
+		Previous: "online",
+		Time:     time.Now(),
+		Duration: 3*time.Hour + 25*time.Minute,
+		Changes:  flapThreshold(),
+	}
+	switch kind {
+	case "online":
+		alert.Status, alert.Previous = "online", "offline"
+	case "status":
+		alert.Status = "idle"
+	case "activity":
+		alert.Status = "online"
+		alert.Activity, alert.PreviousActivity = "Playing maintenance", "Watching 12 servers"
+	}
+	return alert
+}
+
+// name of a guild for templates, its ID if it isn't cached
+func guildName(s *discordgo.Session, GID string) string {
+	if guild, err := s.State.Guild(GID); err == nil {
+		return guild.Name
+	}
+	return GID
+}
+
+// runs one part of a template, a literal \n starts a new line since slash
+// command options can't hold line breaks. Templates can't loop and stop as
+// soon as they write more than limit, so a template can't tie up the bot.
+func executeTemplate(name string, text string, data templateData, limit int) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(strings.ReplaceAll(text, `\n`, "\n"))
+	if err != nil {
+		return "", err
+	}
+	err = checkTemplateNodes(tmpl.Tree.Root)
+	if err != nil {
+		return "", errors.Wrap(err, name)
+	}
+	out := &limitedWriter{limit: limit}
+	err = tmpl.Execute(out, data)
+	if err == errTemplateTooLong {
+		return "", errors.Errorf("%s is longer than %d characters", name, limit)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.buf.String()), nil
+}
+
+var errTemplateTooLong = errors.New("template output too long")
+
+// limitedWriter fails writes once more than limit bytes would be written,
+// which stops the template there
+type limitedWriter struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.buf.Len()+len(p) > w.limit {
+		return 0, errTemplateTooLong
+	}
+	return w.buf.Write(p)
+}
+
+// rejects loops and calls to other templates, the only ways a template can
+// run for long without writing anything
+func checkTemplateNodes(node parse.Node) error {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return nil
+		}
+		for _, child := range node.Nodes {
+			err := checkTemplateNodes(child)
+			if err != nil {
+				return err
+			}
+		}
+	case *parse.IfNode:
+		return checkBranch(node.BranchNode)
+	case *parse.WithNode:
+		return checkBranch(node.BranchNode)
+	case *parse.RangeNode:
+		return errors.New("range can't be used in templates")
+	case *parse.TemplateNode:
+		return errors.New("templates can't call other templates")
+	}
+	return nil
+}
+
+func checkBranch(branch parse.BranchNode) error {
+	err := checkTemplateNodes(branch.List)
+	if err != nil {
+		return err
+	}
+	return checkTemplateNodes(branch.ElseList)
+}
+
+// printf without huge widths or precisions, which fmt would pad out in memory
+// before anything is written
+func templatePrintf(format string, args ...interface{}) (string, error) {
+	for n := 0; n < len(format); n++ {
+		if format[n] != '%' {
+			continue
+		}
+		// the flags, width and precision up to the verb
+		number := 0
+		for n++; n < len(format) && strings.ContainsRune("+-# 0123456789.*[]", rune(format[n])); n++ {
+			switch c := format[n]; {
+			case c == '*':
+				return "", errors.New("printf widths have to be written out")
+			case c >= '0' && c <= '9':
+				number = number*10 + int(c-'0')
+				if number > maxPrintfWidth {
+					return "", errors.Errorf("printf widths can't be over %d", maxPrintfWidth)
+				}
+			default:
+				number = 0
+			}
+		}
+	}
+	return fmt.Sprintf(format, args...), nil
+}
+
+// widest a printf in a template can pad, the longest part of an embed
+const maxPrintfWidth = maxDescriptionLength
+
+// parses a hex color like #ff0000
+func parseColor(text string) (int, error) {
+	text = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(text), "#"), "0x")
+	color, err := strconv.ParseUint(text, 16, 32)
+	if err != nil || len(text) != 6 {
+		return 0, errors.New("invalid color " + text + ", use a hex color like #ff0000")
+	}
+	return int(color), nil
+}
+
+// renders a template over embed, leaving embed untouched if any part fails
+func applyTemplate(embed *discordgo.MessageEmbed, tmpl AlertTemplate, data templateData) error {
+	title, err := executeTemplate("title", tmpl.Title, data, maxTitleLength)
+	if err != nil {
+		return err
+	}
+	description, err := executeTemplate("description", tmpl.Description, data, maxDescriptionLength)
+	if err != nil {
+		return err
+	}
+	colorText, err := executeTemplate("color", tmpl.Color, data, 16)
+	if err != nil {
+		return err
+	}
+	color := embed.Color
+	if colorText != "" {
+		color, err = parseColor(colorText)
+		if err != nil {
+			return err
+		}
+	}
+	footer, err := executeTemplate("footer", tmpl.Footer, data, maxFooterLength)
+	if err != nil {
+		return err
+	}
+
+	if title != "" {
+		embed.Title = title
+	}
+	if description != "" {
+		embed.Description = description
+	}
+	embed.Color = color
+	if footer != "" {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: footer}
+	}
+	return nil
+}
+
+// checks a template renders for every status an alert of its kind can have
+func validateTemplate(kind string, tmpl AlertTemplate) error {
+	for _, status := range []string{"online", "idle", "dnd", "offline"} {
+		alert := sampleAlert(kind, "0", "ExampleBot")
+		alert.Status = status
+		err := applyTemplate(alertEmbed(alert), tmpl, alertData(alert, "Example Server", "0"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the embed for an alert in a guild, with the guild's template if it has one
+func guildAlertEmbed(s *discordgo.Session, guild Guild, alert Alert) *discordgo.MessageEmbed {
+	embed := alertEmbed(alert)
+	tmpl, exists := guild.Settings.Templates[alert.Kind]
+	if !exists {
+		return embed
+	}
+	err := applyTemplate(embed, tmpl, alertData(alert, guildName(s, guild.ID), guild.ID))
+	if err != nil {
+		log.Println("[TEMPLATE] error applying", alert.Kind, "template in", guild.ID, "|", err)
+	}
+	return embed
+}
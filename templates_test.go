@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecuteTemplate(t *testing.T) {
+	alert := Alert{Kind: "offline", BID: "1", Name: "Robot", Status: "offline", Time: time.Unix(1700000000, 0), Duration: 90 * time.Minute}
+	data := alertData(alert, "Example Server", "2")
+	for _, test := range []struct {
+		text string
+		want string
+	}{
+		{`{{.Bot}} is {{.Status | upper}}\nsince <t:{{.Timestamp}}:R>`, "Robot is OFFLINE\nsince <t:1700000000:R>"},
+		{`{{if eq .Status "offline"}}down{{else}}up{{end}} in {{.Guild}}`, "down in Example Server"},
+		{`{{with .Bot}}{{printf "%-8s|" .}}{{end}}`, "Robot   |"},
+	} {
+		got, err := executeTemplate("description", test.text, data, maxDescriptionLength)
+		if err != nil || got != test.want {
+			t.Errorf("%s = %q, %v, want %q", test.text, got, err, test.want)
+		}
+	}
+}
+
+// templates come from server admins, none of these may hang the bot or fill
+// its memory
+func TestExecuteTemplateLimits(t *testing.T) {
+	data := alertData(sampleAlert("offline", "1", "Robot"), "Example Server", "2")
+	for _, test := range []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		{`{{range 100000}}{{range 1000}}x{{end}}{{end}}`, maxDescriptionLength, "range"},
+		{`{{if true}}{{range 100000}}{{end}}{{end}}`, maxDescriptionLength, "range"},
+		{`{{with .Bot}}{{else}}{{range 10}}{{end}}{{end}}`, maxDescriptionLength, "range"},
+		{`{{define "loop"}}{{template "loop" .}}{{end}}{{template "loop" .}}`, maxDescriptionLength, "other templates"},
+		{`{{block "b" .}}x{{end}}`, maxDescriptionLength, "other templates"},
+		{`{{printf "%01000000000d" 1}}`, maxDescriptionLength, "widths"},
+		{`{{printf "%.999999f" 1.0}}`, maxDescriptionLength, "widths"},
+		{`{{printf "%*d" 1000000000 1}}`, maxDescriptionLength, "widths"},
+		{`{{printf "%0300d" 1}}`, maxTitleLength, "longer than 256"},
+		{strings.Repeat("{{.Bot}}", 100), maxTitleLength, "longer than 256"},
+	} {
+		start := time.Now()
+		_, err := executeTemplate("title", test.text, data, test.limit)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error %v, want one about %q", test.text, err, test.want)
+		}
+		if took := time.Since(start); took > time.Second {
+			t.Errorf("%s: took %v", test.text, took)
+		}
+	}
+}
+
+func TestLimitedWriterStopsWriting(t *testing.T) {
+	out := &limitedWriter{limit: 10}
+	if _, err := out.Write([]byte("12345")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := out.Write([]byte("123456")); err != errTemplateTooLong {
+		t.Errorf("write past the limit: %v", err)
+	}
+	if out.buf.Len() != 5 {
+		t.Errorf("buffered %d bytes, want 5", out.buf.Len())
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	err := validateTemplate("offline", AlertTemplate{Title: "{{.Bot}} went {{.Status}}", Color: "#ff0000"})
+	if err != nil {
+		t.Errorf("valid template: %v", err)
+	}
+	err = validateTemplate("offline", AlertTemplate{Description: `{{range 100000}}{{range 1000}}x{{end}}{{end}}`})
+	if err == nil {
+		t.Error("template with range was accepted")
+	}
+	err = validateTemplate("offline", AlertTemplate{Title: "{{.Missing}}"})
+	if err == nil {
+		t.Error("template with a missing field was accepted")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ----- UPTIME
+
+// windows reported by /uptime
+var uptimeWindows = []struct {
+	name   string
+	window time.Duration
+}{
+	{"24 hours", 24 * time.Hour},
+	{"7 days", 7 * 24 * time.Hour},
+	{"30 days", 30 * 24 * time.Hour},
+	{"90 days", 90 * 24 * time.Hour},
+}
+
+// statusSpan is a stretch of time a bot spent in one status
+type statusSpan struct {
+	status string
+	start  time.Time
+	end    time.Time
+	// still going on at the time the spans were made
+	ongoing bool
+}
+
+// uptimeReport sums up a bot's availability over a window
+type uptimeReport struct {
+	window time.Duration
+	// the part of the window covered by history
+	covered time.Duration
+	up      time.Duration
+	down    time.Duration
+	// outages that started inside the window
+	outages int
+	longest time.Duration
+	// mean time to recovery of the outages that are over
+	mttr time.Duration
+}
+
+// turns a bot's history into spans ending at now. History starts at the first
+// recorded change, or at the bot's last offline/online change if there's none.
+func statusSpans(bot Bot, events []StatusEvent, now time.Time) (spans []statusSpan) {
+	if len(events) == 0 {
+		return []statusSpan{{status: bot.Status, start: time.Unix(bot.Timestamp, 0), end: now, ongoing: true}}
+	}
+	for i, event := range events {
+		span := statusSpan{status: event.Status, start: time.Unix(event.Time, 0), end: now, ongoing: true}
+		if i+1 < len(events) {
+			span.end = time.Unix(events[i+1].Time, 0)
+			span.ongoing = false
+		}
+		spans = append(spans, span)
+	}
+	return
+}
+
+// sums up spans over the window ending at now
+func makeUptimeReport(spans []statusSpan, now time.Time, window time.Duration) (report uptimeReport) {
+	report.window = window
+	windowStart := now.Add(-window)
+	var recovered int
+	var recovery time.Duration
+	for _, span := range spans {
+		start, end := span.start, span.end
+		if start.Before(windowStart) {
+			start = windowStart
+		}
+		if !end.After(start) {
+			continue
+		}
+		switch span.status {
+		case "unknown":
+			continue
+		case "offline":
+			report.down += end.Sub(start)
+			if span.start.Before(windowStart) {
+				break
+			}
+			report.outages++
+			length := span.end.Sub(span.start)
+			if length > report.longest {
+				report.longest = length
+			}
+			if !span.ongoing {
+				recovered++
+				recovery += length
+			}
+		default:
+			report.up += end.Sub(start)
+		}
+	}
+	report.covered = report.up + report.down
+	if recovered > 0 {
+		report.mttr = recovery / time.Duration(recovered)
+	}
+	return
+}
+
+// share of the covered time the bot was up, 0 to 100
+func (report uptimeReport) availability() float64 {
+	if report.covered == 0 {
+		return 0
+	}
+	return 100 * float64(report.up) / float64(report.covered)
+}
+
+// ----- OUTAGES
+
+// a bot's offline spans that were still going on at or after since, newest first
+func outages(bot Bot, events []StatusEvent, since time.Time, now time.Time) (spans []statusSpan) {
+	all := statusSpans(bot, events, now)
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].status == "offline" && all[i].end.After(since) {
+			spans = append(spans, all[i])
+		}
+	}
+	return
+}
+
+// parses how far back to look, a go duration such as "36h" or a number of
+// days or weeks such as "7d" or "2w". Nothing older than the history's
+// retention is kept, so longer durations are cut down to it.
+func parseSince(text string) (time.Duration, error) {
+	text = strings.TrimSpace(text)
+	limit := historyRetention()
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, found := strings.CutSuffix(text, suffix); found {
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil || !(n > 0) {
+				return 0, errors.New("invalid duration " + text)
+			}
+			// checked before converting, a time.Duration overflows past 292 years
+			if n*float64(unit) > float64(limit) {
+				return limit, nil
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(text)
+	if err == nil && d <= 0 {
+		err = errors.New("invalid duration " + text)
+	}
+	if d > limit {
+		d = limit
+	}
+	return d, err
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatusSpans(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	hoursAgo := func(h int) time.Time { return now.Add(-time.Duration(h) * time.Hour) }
+
+	// no history falls back to the bot's last change
+	bot := Bot{ID: "1", Status: "online", Timestamp: hoursAgo(5).Unix()}
+	spans := statusSpans(bot, nil, now)
+	if len(spans) != 1 || spans[0] != (statusSpan{status: "online", start: hoursAgo(5), end: now, ongoing: true}) {
+		t.Errorf("spans without history = %+v", spans)
+	}
+
+	events := []StatusEvent{
+		{BID: "1", Previous: "unknown", Status: "online", Time: hoursAgo(10).Unix()},
+		{BID: "1", Previous: "online", Status: "offline", Time: hoursAgo(4).Unix()},
+	}
+	spans = statusSpans(bot, events, now)
+	want := []statusSpan{
+		{status: "online", start: hoursAgo(10), end: hoursAgo(4)},
+		{status: "offline", start: hoursAgo(4), end: now, ongoing: true},
+	}
+	if len(spans) != len(want) {
+		t.Fatalf("spans = %+v, want %+v", spans, want)
+	}
+	for n := range want {
+		if spans[n] != want[n] {
+			t.Errorf("span %d = %+v, want %+v", n, spans[n], want[n])
+		}
+	}
+}
+
+func TestMakeUptimeReport(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	hoursAgo := func(h int) time.Time { return now.Add(-time.Duration(h) * time.Hour) }
+	span := func(status string, from int, to int) statusSpan {
+		return statusSpan{status: status, start: hoursAgo(from), end: hoursAgo(to), ongoing: to == 0}
+	}
+
+	for _, test := range []struct {
+		name  string
+		spans []statusSpan
+		want  uptimeReport
+	}{
+		{
+			name:  "online span starting before the window is clipped",
+			spans: []statusSpan{span("online", 48, 12), span("offline", 12, 6), span("online", 6, 0)},
+			want:  uptimeReport{covered: 24 * time.Hour, up: 18 * time.Hour, down: 6 * time.Hour, outages: 1, longest: 6 * time.Hour, mttr: 6 * time.Hour},
+		},
+		{
+			name:  "outage starting before the window counts as downtime only",
+			spans: []statusSpan{span("offline", 30, 20), span("online", 20, 0)},
+			want:  uptimeReport{covered: 24 * time.Hour, up: 20 * time.Hour, down: 4 * time.Hour},
+		},
+		{
+			name:  "ongoing outage doesn't count toward mttr",
+			spans: []statusSpan{span("online", 24, 10), span("offline", 10, 8), span("online", 8, 3), span("offline", 3, 0)},
+			want:  uptimeReport{covered: 24 * time.Hour, up: 19 * time.Hour, down: 5 * time.Hour, outages: 2, longest: 3 * time.Hour, mttr: 2 * time.Hour},
+		},
+		{
+			name:  "unknown time isn't covered",
+			spans: []statusSpan{span("unknown", 24, 12), span("idle", 12, 0)},
+			want:  uptimeReport{covered: 12 * time.Hour, up: 12 * time.Hour},
+		},
+		{
+			name:  "spans that ended before the window are left out",
+			spans: []statusSpan{span("offline", 50, 30), span("dnd", 30, 0)},
+			want:  uptimeReport{covered: 24 * time.Hour, up: 24 * time.Hour},
+		},
+	} {
+		test.want.window = 24 * time.Hour
+		got := makeUptimeReport(test.spans, now, 24*time.Hour)
+		if got != test.want {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestUptimeAvailability(t *testing.T) {
+	for _, test := range []struct {
+		report uptimeReport
+		want   float64
+	}{
+		{uptimeReport{covered: 24 * time.Hour, up: 18 * time.Hour, down: 6 * time.Hour}, 75},
+		{uptimeReport{covered: 12 * time.Hour, up: 12 * time.Hour}, 100},
+		{uptimeReport{}, 0},
+	} {
+		if got := test.report.availability(); got != test.want {
+			t.Errorf("availability of %+v = %v, want %v", test.report, got, test.want)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	t.Setenv("HISTORY_RETENTION", "")
+	day := 24 * time.Hour
+	for _, test := range []struct {
+		text string
+		want time.Duration
+		fail bool
+	}{
+		{text: "7d", want: 7 * day},
+		{text: "2w", want: 14 * day},
+		{text: "36h", want: 36 * time.Hour},
+		{text: " 1.5d ", want: 36 * time.Hour},
+		// longer than the history is kept, 90 days by default
+		{text: "1e300d", want: 90 * day},
+		{text: "100w", want: 90 * day},
+		{text: "9000h", want: 90 * day},
+		{text: "0d", fail: true},
+		{text: "-2w", fail: true},
+		{text: "NaNd", fail: true},
+		{text: "week", fail: true},
+		{text: "", fail: true},
+	} {
+		got, err := parseSince(test.text)
+		if test.fail {
+			if err == nil {
+				t.Errorf("parseSince(%q) = %v, want an error", test.text, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseSince(%q) = %v, %v, want %v", test.text, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ----- WEBHOOKS
+
+// webhookEvent is the JSON posted to a webhook for every alert
+type webhookEvent struct {
+	// the alert kind, "offline", "online", "flapping", "stable", "status",
+	// "activity", or "test" for /webhook test
+	Event            string `json:"event"`
+	BotID            string `json:"botId"`
+	BotName          string `json:"botName"`
+	GuildID          string `json:"guildId"`
+	Status           string `json:"status"`
+	Previous         string `json:"previous"`
+	Activity         string `json:"activity,omitempty"`
+	PreviousActivity string `json:"previousActivity,omitempty"`
+	// unix time of the alert and of the start of the status Duration measures
+	Time  int64 `json:"time"`
+	Since int64 `json:"since"`
+	// seconds the previous status lasted, or the current one for "stable"
+	Duration int64 `json:"duration"`
+	// offline/online changes seen while flapping
+	Changes int `json:"changes,omitempty"`
+}
+
+func makeWebhookEvent(GID string, alert Alert) webhookEvent {
+	return webhookEvent{
+		Event:            alert.Kind,
+		BotID:            alert.BID,
+		BotName:          alert.Name,
+		GuildID:          GID,
+		Status:           alert.Status,
+		Previous:         alert.Previous,
+		Activity:         alert.Activity,
+		PreviousActivity: alert.PreviousActivity,
+		Time:             alert.Time.Unix(),
+		Since:            alert.Time.Add(-alert.Duration).Unix(),
+		Duration:         int64(alert.Duration.Seconds()),
+		Changes:          alert.Changes,
+	}
+}
+
+// whether webhooks may post to plain http and private addresses, for trying
+// them out against a local server
+func webhookAllowPrivate() bool {
+	return os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"
+}
+
+// never follows redirects or connects to private addresses, so a webhook URL
+// can't be used to reach the host's own network
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 5 * time.Second, Control: publicOnly}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func publicOnly(network string, address string, c syscall.RawConn) error {
+	if webhookAllowPrivate() {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return errors.New("refusing to post to private address " + host)
+	}
+	return nil
+}
+
+// checks a webhook URL before it's saved
+func validateWebhookURL(text string) error {
+	u, err := url.Parse(text)
+	if err != nil {
+		return errors.New("invalid URL")
+	}
+	if u.Host == "" || (u.Scheme != "https" && !(u.Scheme == "http" && webhookAllowPrivate())) {
+		return errors.New("webhook URLs have to use https")
+	}
+	return nil
+}
+
+// makes a new signing secret
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// signs a payload sent at timestamp, receivers recompute this over the
+// X-OfflineNotifier-Timestamp header, a dot and the body
+func webhookSignature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookNotifier posts alerts to a guild's webhook
+type webhookNotifier struct {
+	GID      string
+	settings WebhookSettings
+}
+
+func (wn *webhookNotifier) Notify(alert Alert) error {
+	body, err := json.Marshal(makeWebhookEvent(wn.GID, alert))
+	if err != nil {
+		return err
+	}
+	return postWebhook(wn.settings, body)
+}
+
+func (wn *webhookNotifier) Kind() string {
+	return "webhook"
+}
+
+func (wn *webhookNotifier) String() string {
+	return "webhook of " + wn.GID
+}
+
+// posts body once, network errors, rate limits and server errors are worth
+// retrying
+func postWebhook(settings WebhookSettings, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, settings.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "OfflineNotifier")
+	req.Header.Set("X-OfflineNotifier-Timestamp", timestamp)
+	req.Header.Set("X-OfflineNotifier-Signature", webhookSignature(settings.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return retryLater(err, 0)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = errors.New("webhook responded " + resp.Status)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500 {
+		return retryLater(err, retryAfter(resp.Header.Get("Retry-After")))
+	}
+	return err
+}